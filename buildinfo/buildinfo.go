@@ -0,0 +1,101 @@
+// Package buildinfo exposes the build metadata of a binary built with mageproj.
+//
+// Importing this package is enough: mageproj sets its values with ldflags when
+// building, and it falls back to the VCS information stamped by go build otherwise.
+package buildinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// set with -ldflags -X by mageproj
+var (
+	version   string
+	commit    string
+	buildDate string
+)
+
+// Info holds the build metadata
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+var (
+	info     Info
+	infoOnce sync.Once
+)
+
+// Get returns the build metadata
+func Get() Info {
+	infoOnce.Do(func() {
+		info = Info{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version()}
+
+		bi, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		modified := false
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		if modified && commit == "" && info.Commit != "" {
+			info.Commit += "-dirty"
+		}
+	})
+	return info
+}
+
+// Version returns the version of the binary (git tag or dev@<rev>)
+func Version() string {
+	return Get().Version
+}
+
+// Commit returns the git revision the binary was built from
+func Commit() string {
+	return Get().Commit
+}
+
+// BuildDate returns the date the binary was built
+func BuildDate() string {
+	return Get().BuildDate
+}
+
+// String returns a one line description of the build
+func String() string {
+	i := Get()
+	v := i.Version
+	if v == "" {
+		v = "unknown"
+	}
+	return fmt.Sprintf("%s (commit %s, built %s with %s)", v, i.Commit, i.BuildDate, i.GoVersion)
+}
+
+// Handler returns an HTTP handler serving the build metadata as JSON
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Get())
+	})
+}
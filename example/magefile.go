@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/voyages-sncf-technologies/mageproj/v2/mgl"
 	"github.com/voyages-sncf-technologies/mageproj/v2/mgp"
 )
 
@@ -29,13 +30,18 @@ func init() {
 	withLdFlags := mgp.WithCompileFlags(ldFlags)
 	withArtURL := mgp.WithArtifactURL(artifactURL)
 	withGitURL := mgp.WithGitURL(gitURL)
+	withEnv := mgp.WithEnv(mgl.Env{})
+	if _, present := os.LookupEnv("MAGEFILEP_ARTIFACT_USR"); !present {
+		// default user, the process environment is left untouched
+		withEnv = mgp.WithEnv(mgl.Env{"MAGEFILEP_ARTIFACT_USR": "myuser"})
+	}
 
 	mgp.Logf(">> Using packageName %s\n", packageName)
 	mgp.Logf(">> Using artifactURL %s\n", artifactURL)
 	mgp.Logf(">> Using gitURL %s\n", gitURL)
 
 	proj = mgp.NewMageProject(currentDir(), projectName, packageName,
-		withLdFlags, withArtURL, withGitURL)
+		withLdFlags, withArtURL, withGitURL, withEnv)
 }
 
 func currentDir() string {
@@ -51,11 +57,41 @@ func Validate() error {
 	return proj.Validate()
 }
 
+// FormatFix formats code in place with gofmt and goimports
+func FormatFix() error {
+	return proj.FormatFix()
+}
+
 // Test runs tests with go test
 func Test() error {
 	return proj.Test()
 }
 
+// IntegrationTest runs integration tests with go test
+func IntegrationTest() error {
+	return proj.IntegrationTest()
+}
+
+// Coverage reports the coverage of the tests
+func Coverage() error {
+	return proj.Coverage()
+}
+
+// Bench runs benchmarks and compares them to a baseline
+func Bench() error {
+	return proj.Bench()
+}
+
+// Fuzz runs fuzz tests
+func Fuzz() error {
+	return proj.Fuzz()
+}
+
+// CheckGoVersion checks the version of the go command
+func CheckGoVersion() error {
+	return proj.CheckGoVersion()
+}
+
 // Build builds binary in build dir
 func Build() error {
 	return proj.Build()
@@ -73,11 +109,7 @@ func Release() error {
 
 // Deploy deploys x-platform binaries to artifact registry
 func Deploy() error {
-	_, present := os.LookupEnv("MAGEFILEP_ARTIFACT_USR")
-	if !present {
-		os.Setenv("MAGEFILEP_ARTIFACT_USR", "myuser")
-	}
-	_, present = os.LookupEnv("MAGEFILEP_ARTIFACT_PWD")
+	_, present := os.LookupEnv("MAGEFILEP_ARTIFACT_PWD")
 	if !present {
 		return errors.New("missing password for Artifactory (set variable MAGEFILEP_ARTIFACT_PWD)")
 	}
@@ -94,3 +126,8 @@ func Clean() error {
 func ChangeLog() error {
 	return proj.ChangeLog()
 }
+
+// Config prints the effective configuration
+func Config() error {
+	return proj.Config()
+}
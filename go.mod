@@ -1,8 +1,10 @@
 module github.com/voyages-sncf-technologies/mageproj/v2
 
-go 1.12
+go 1.17
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/magefile/mage v1.11.0
 	github.com/voyages-sncf-technologies/mageproj v1.0.6
+	gopkg.in/yaml.v3 v3.0.1
 )
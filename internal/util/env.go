@@ -0,0 +1,198 @@
+package util
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Env holds environment variables set on top of the process environment.
+// Commands run through an Env get these variables, without the process
+// environment being modified. A nil or empty Env is the process environment.
+type Env map[string]string
+
+// With returns a copy of the environment with the given variables set
+func (e Env) With(vars map[string]string) Env {
+	env := make(Env, len(e)+len(vars))
+	for k, v := range e {
+		env[k] = v
+	}
+	for k, v := range vars {
+		env[k] = v
+	}
+	return env
+}
+
+// Lookup returns the value of a variable, from the process environment if not set
+func (e Env) Lookup(key string) (string, bool) {
+	if val, present := e[key]; present {
+		return val, true
+	}
+	return os.LookupEnv(key)
+}
+
+// Get returns the value of a variable, empty if not set
+func (e Env) Get(key string) string {
+	val, _ := e.Lookup(key)
+	return val
+}
+
+// Expand replaces $var or ${var} in s according to the environment
+func (e Env) Expand(s string) string {
+	return os.Expand(s, e.Get)
+}
+
+// Environ returns the process environment with the variables set, as KEY=VALUE
+func (e Env) Environ() []string {
+	if len(e) == 0 {
+		return os.Environ()
+	}
+
+	var environ []string
+	for _, kv := range os.Environ() {
+		if i := strings.Index(kv, "="); i > 0 {
+			if _, present := e[kv[:i]]; present {
+				continue
+			}
+		}
+		environ = append(environ, kv)
+	}
+
+	keys := make([]string, 0, len(e))
+	for k := range e {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		environ = append(environ, k+"="+e[k])
+	}
+	return environ
+}
+
+// Verbose reports whether a magefile was run with the verbose flag.
+func (e Env) Verbose() bool {
+	b, _ := strconv.ParseBool(e.Get("MAGEFILE_VERBOSE"))
+	return b
+}
+
+// GoCmd reports the command to use to build go code. By default it is
+// the "go" binary in the PATH.
+func (e Env) GoCmd() string {
+	if val, present := e.Lookup("MAGEFILE_GOCMD"); present {
+		return val
+	}
+	return "go"
+}
+
+// GitCmd reports the command to use to extract git info. By default it is
+// the "git" binary in the PATH.
+func (e Env) GitCmd() string {
+	if val, present := e.Lookup("MAGEFILEP_GITCMD"); present {
+		return val
+	}
+	return "git"
+}
+
+// LookPath searches for an executable in the directories of the PATH variable,
+// as exec.LookPath does, so that a PATH set in the environment is honored
+func (e Env) LookPath(file string) (string, error) {
+	path, present := e["PATH"]
+	if !present || strings.ContainsAny(file, `/\`) {
+		return exec.LookPath(file)
+	}
+
+	names := []string{file}
+	if runtime.GOOS == "windows" && filepath.Ext(file) == "" {
+		names = []string{file + ".exe", file}
+	}
+	for _, dir := range filepath.SplitList(path) {
+		for _, name := range names {
+			candidate := filepath.Join(dir, name)
+			fi, err := os.Stat(candidate)
+			if err == nil && !fi.IsDir() && (runtime.GOOS == "windows" || fi.Mode()&0111 != 0) {
+				return candidate, nil
+			}
+		}
+	}
+	return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+}
+
+// Command returns the command to run with the environment
+func (e Env) Command(name string, arg ...string) *exec.Cmd {
+	return e.CommandIn("", name, arg...)
+}
+
+// CommandIn returns the command to run with the environment in dir,
+// the current directory if empty
+func (e Env) CommandIn(dir, name string, arg ...string) *exec.Cmd {
+	if path, err := e.LookPath(name); err == nil {
+		name = path
+	}
+	c := exec.Command(name, arg...)
+	c.Dir = dir
+	if len(e) > 0 {
+		c.Env = e.Environ()
+	}
+	return c
+}
+
+// RunCmd runs the given command displaying its standard output if in verbose mode
+func (e Env) RunCmd(name string, arg ...string) error {
+	return e.RunCmdIn("", name, arg...)
+}
+
+// RunCmdIn runs the given command in dir displaying its standard output if in verbose mode
+func (e Env) RunCmdIn(dir, name string, arg ...string) error {
+	out, err := e.CommandIn(dir, name, arg...).CombinedOutput()
+	if e.Verbose() && len(out) > 0 {
+		AlwaysLog(string(out))
+	}
+	return err
+}
+
+// RunCmdStreamed runs the given command streaming its standard error, and its
+// standard output if in verbose mode, as long-running commands (e.g. builds) do
+func (e Env) RunCmdStreamed(name string, arg ...string) error {
+	return e.RunCmdStreamedIn("", name, arg...)
+}
+
+// RunCmdStreamedIn runs the given command in dir as RunCmdStreamed does
+func (e Env) RunCmdStreamedIn(dir, name string, arg ...string) error {
+	c := e.CommandIn(dir, name, arg...)
+	c.Stderr = os.Stderr
+	if e.Verbose() {
+		c.Stdout = os.Stdout
+	}
+	return c.Run()
+}
+
+// RunCmdWithInput runs the given command writing input to its standard input,
+// so that secrets are not visible in the process list
+func (e Env) RunCmdWithInput(input, name string, arg ...string) error {
+	c := e.Command(name, arg...)
+	c.Stdin = strings.NewReader(input)
+
+	out, err := c.CombinedOutput()
+	if e.Verbose() && len(out) > 0 {
+		AlwaysLog(string(out))
+	}
+	return err
+}
+
+// ExecOutput executes a command and returns its standard output
+func (e Env) ExecOutput(cmd string, args ...string) (string, error) {
+	return e.ExecOutputIn("", cmd, args...)
+}
+
+// ExecOutputIn executes a command in dir and returns its standard output
+func (e Env) ExecOutputIn(dir, cmd string, args ...string) (string, error) {
+	out, err := e.CommandIn(dir, cmd, args...).Output()
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
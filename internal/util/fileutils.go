@@ -7,7 +7,6 @@ import (
 	"encoding/hex"
 	"io"
 	"os"
-	"os/exec"
 )
 
 // FileDetails provides check sums and size for a given file
@@ -111,12 +110,5 @@ func sumFile(hasher io.Writer, file string) error {
 
 // ExecOutput executes a command and returns its standard output
 func ExecOutput(cmd string, args ...string) (string, error) {
-	out, err := exec.Command(cmd, args...).Output()
-	if err != nil {
-		return "", err
-	}
-	if len(out) > 0 {
-		return string(out), nil
-	}
-	return "", nil
+	return Env(nil).ExecOutput(cmd, args...)
 }
@@ -1,48 +1,35 @@
 package util
 
-import (
-	"os"
-	"os/exec"
-	"strconv"
-)
-
 // RunCmd runs the given command displaying its standard output if in verbose mode
 func RunCmd(name string, arg ...string) error {
-	c := exec.Command(name, arg...)
+	return Env(nil).RunCmd(name, arg...)
+}
 
-	out, err := c.CombinedOutput()
-	if Verbose() && out != nil && len(out) > 0 {
-		AlwaysLog(string(out))
-	}
-	return err
+// RunCmdStreamed runs the given command streaming its standard error, and its
+// standard output if in verbose mode, as long-running commands (e.g. builds) do
+func RunCmdStreamed(name string, arg ...string) error {
+	return Env(nil).RunCmdStreamed(name, arg...)
+}
+
+// RunCmdWithInput runs the given command writing input to its standard input,
+// so that secrets are not visible in the process list
+func RunCmdWithInput(input, name string, arg ...string) error {
+	return Env(nil).RunCmdWithInput(input, name, arg...)
 }
 
 // Verbose reports whether a magefile was run with the verbose flag.
 func Verbose() bool {
-	val, present := os.LookupEnv("MAGEFILE_VERBOSE")
-	if present {
-		b, _ := strconv.ParseBool(val)
-		return b
-	}
-	return false
+	return Env(nil).Verbose()
 }
 
 // GoCmd reports the command to use to build go code. By default it is
 // the "go" binary in the PATH.
 func GoCmd() string {
-	val, present := os.LookupEnv("MAGEFILE_GOCMD")
-	if present {
-		return val
-	}
-	return "go"
+	return Env(nil).GoCmd()
 }
 
 // GitCmd reports the command to use to extract git info. By default it is
-// the "go" binary in the PATH.
+// the "git" binary in the PATH.
 func GitCmd() string {
-	val, present := os.LookupEnv("MAGEFILEP_GITCMD")
-	if present {
-		return val
-	}
-	return "git"
+	return Env(nil).GitCmd()
 }
@@ -0,0 +1,103 @@
+package util
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var semverRegexp = regexp.MustCompile(`^v?([0-9]+)\.([0-9]+)\.([0-9]+)(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// SemVer holds a parsed semantic version
+type SemVer struct {
+	Major      int
+	Minor      int
+	Patch      int
+	PreRelease string
+}
+
+// ParseSemVer parses a version like v1.2.3 or 1.2.3-rc.1, the 'v' prefix being optional
+func ParseSemVer(val string) (SemVer, bool) {
+	match := semverRegexp.FindStringSubmatch(val)
+	if match == nil {
+		return SemVer{}, false
+	}
+	v := SemVer{PreRelease: match[4]}
+	v.Major, _ = strconv.Atoi(match[1])
+	v.Minor, _ = strconv.Atoi(match[2])
+	v.Patch, _ = strconv.Atoi(match[3])
+	return v, true
+}
+
+// String returns the version without 'v' prefix
+func (v SemVer) String() string {
+	s := strconv.Itoa(v.Major) + "." + strconv.Itoa(v.Minor) + "." + strconv.Itoa(v.Patch)
+	if v.PreRelease != "" {
+		s += "-" + v.PreRelease
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 whether v is lower, equal or greater than o, following
+// SemVer precedence: a release is greater than any of its pre-releases, whose
+// dot-separated identifiers are compared one by one (see ComparePreRelease).
+func (v SemVer) Compare(o SemVer) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	switch {
+	case v.PreRelease == o.PreRelease:
+		return 0
+	case v.PreRelease == "":
+		return 1
+	case o.PreRelease == "":
+		return -1
+	}
+	return ComparePreRelease(v.PreRelease, o.PreRelease)
+}
+
+// ComparePreRelease returns -1, 0 or 1 whether the pre-release a is lower, equal or
+// greater than b, comparing their dot-separated identifiers one by one: numerically
+// when both are numeric, numeric ones being lower than the others, in ASCII order
+// otherwise, and a shorter pre-release being lower when all its identifiers are equal
+// (e.g. alpha < alpha.1 < alpha.beta < beta.2 < beta.11 < rc.1)
+func ComparePreRelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := compareIdentifier(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+func compareIdentifier(a, b string) int {
+	na, aErr := strconv.ParseUint(a, 10, 64)
+	nb, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		if na < nb {
+			return -1
+		}
+		if na > nb {
+			return 1
+		}
+		return 0
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
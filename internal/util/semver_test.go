@@ -0,0 +1,91 @@
+package util
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestParseSemVer(t *testing.T) {
+	tests := []struct {
+		val  string
+		want SemVer
+		ok   bool
+	}{
+		{"v1.2.3", SemVer{Major: 1, Minor: 2, Patch: 3}, true},
+		{"1.2.3", SemVer{Major: 1, Minor: 2, Patch: 3}, true},
+		{"v10.20.30-rc.1", SemVer{Major: 10, Minor: 20, Patch: 30, PreRelease: "rc.1"}, true},
+		{"1.0.0-alpha-beta.x-y", SemVer{Major: 1, PreRelease: "alpha-beta.x-y"}, true},
+		{"1.0.0+build.5", SemVer{Major: 1}, true},
+		{"1.0.0-rc.2+build.5", SemVer{Major: 1, PreRelease: "rc.2"}, true},
+		{"1.2", SemVer{}, false},
+		{"v1.2.3.4", SemVer{}, false},
+		{"release-1", SemVer{}, false},
+		{"1.2.3-", SemVer{}, false},
+		{"", SemVer{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.val, func(t *testing.T) {
+			got, ok := ParseSemVer(tt.val)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("ParseSemVer(%q) = %+v, %v, want %+v, %v", tt.val, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSemVerString(t *testing.T) {
+	for val, want := range map[string]string{"v1.2.3": "1.2.3", "1.2.3-rc.1+build": "1.2.3-rc.1"} {
+		v, _ := ParseSemVer(val)
+		if got := v.String(); got != want {
+			t.Errorf("ParseSemVer(%q).String() = %q, want %q", val, got, want)
+		}
+	}
+}
+
+func TestSemVerCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2.3", "v1.2.3+build", 0},
+		{"1.2.3", "1.2.4", -1},
+		{"1.3.0", "1.2.9", 1},
+		{"2.0.0", "1.99.99", 1},
+		{"1.0.0", "1.0.0-rc.1", 1},
+		{"1.0.0-rc.1", "1.0.0", -1},
+		{"1.0.0-rc.9", "1.0.0-rc.10", -1},
+		{"1.0.0-rc.10", "1.0.0-rc.9", 1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-beta", "1.0.0-alpha.beta", 1},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"1.0.0-beta.11", "1.0.0-rc.1", -1},
+		{"1.0.0-rc.1", "1.0.0-rc.1", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			a, _ := ParseSemVer(tt.a)
+			b, _ := ParseSemVer(tt.b)
+			if got := a.Compare(b); got != tt.want {
+				t.Errorf("%s.Compare(%s) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSemVerPrecedence(t *testing.T) {
+	// example of the SemVer specification
+	want := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2",
+		"1.0.0-beta.11", "1.0.0-rc.1", "1.0.0"}
+	versions := make([]SemVer, len(want))
+	for i, val := range want {
+		versions[len(want)-1-i], _ = ParseSemVer(val)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Compare(versions[j]) < 0 })
+	for i, v := range versions {
+		if v.String() != want[i] {
+			t.Errorf("sorted versions[%d] = %s, want %s", i, v, want[i])
+		}
+	}
+}
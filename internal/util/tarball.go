@@ -3,8 +3,10 @@ package util
 import (
 	"archive/tar"
 	"compress/gzip"
+	"fmt"
 	"io"
 	"os"
+	"path"
 )
 
 // From https://www.arthurkoziel.com/writing-tar-gz-files-in-go/
@@ -88,3 +90,45 @@ func addToArchive(tw *tar.Writer, filename string, preserveDir bool) error {
 
 	return nil
 }
+
+// UntarFile extracts the file of the tar.gz archive having the given base name into dst
+func UntarFile(filename, name, dst string) error {
+	in, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	gr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("%s not found in %s", name, filename)
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg && path.Base(header.Name) == name {
+			return writeFile(dst, tr, header.FileInfo().Mode())
+		}
+	}
+}
+
+// writeFile writes the content read from r into filename
+func writeFile(filename string, r io.Reader, mode os.FileMode) error {
+	out, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -2,8 +2,10 @@ package util
 
 import (
 	"archive/zip"
+	"fmt"
 	"io"
 	"os"
+	"path"
 )
 
 // ZipFiles compresses one or many files into a single zip archive file.
@@ -54,3 +56,25 @@ func ZipFiles(filename string, files []string) error {
 
 	return nil
 }
+
+// UnzipFile extracts the file of the zip archive having the given base name into dst
+func UnzipFile(filename, name, dst string) error {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || path.Base(f.Name) != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return writeFile(dst, rc, f.Mode())
+	}
+	return fmt.Errorf("%s not found in %s", name, filename)
+}
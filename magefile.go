@@ -48,11 +48,41 @@ func Validate() error {
 	return proj.Validate()
 }
 
+// FormatFix formats code in place with gofmt and goimports
+func FormatFix() error {
+	return proj.FormatFix()
+}
+
 // Test runs tests with go test
 func Test() error {
 	return proj.Test()
 }
 
+// IntegrationTest runs integration tests with go test
+func IntegrationTest() error {
+	return proj.IntegrationTest()
+}
+
+// Coverage reports the coverage of the tests
+func Coverage() error {
+	return proj.Coverage()
+}
+
+// Bench runs benchmarks and compares them to a baseline
+func Bench() error {
+	return proj.Bench()
+}
+
+// Fuzz runs fuzz tests
+func Fuzz() error {
+	return proj.Fuzz()
+}
+
+// CheckGoVersion checks the version of the go command
+func CheckGoVersion() error {
+	return proj.CheckGoVersion()
+}
+
 // Build builds binary in build dir
 func Build() error {
 	return proj.Build()
@@ -72,3 +102,8 @@ func Release() error {
 func ChangeLog() error {
 	return proj.ChangeLog()
 }
+
+// Config prints the effective configuration
+func Config() error {
+	return proj.Config()
+}
@@ -0,0 +1,318 @@
+package mgl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+)
+
+// Benchmark holds the samples of a benchmark, as printed by go test -bench
+type Benchmark struct {
+	Package string
+	Name    string               // e.g. BenchmarkEncode/small-8
+	Samples map[string][]float64 // values by unit (ns/op, B/op, allocs/op, MB/s...)
+}
+
+// BenchSummary holds the statistics of the samples of a benchmark in a unit,
+// outliers excluded
+type BenchSummary struct {
+	Median float64
+	Spread float64 // largest deviation from the median, in percent of it
+	N      int     // samples kept
+}
+
+// BenchDelta holds the comparison of a benchmark in a unit between a baseline
+// and new results
+type BenchDelta struct {
+	Package string
+	Name    string
+	Unit    string
+	Old     BenchSummary
+	New     BenchSummary
+	Change  float64 // change of the median, in percent, positive when worse
+	P       float64 // p-value of the Mann-Whitney U-test
+}
+
+// Significant reports whether the change is statistically significant at level alpha
+func (d BenchDelta) Significant(alpha float64) bool {
+	return d.P < alpha
+}
+
+// ParseBenchmarks parses the output of go test -bench, gathering the samples of
+// the benchmarks run several times (-count)
+func ParseBenchmarks(r io.Reader) ([]*Benchmark, error) {
+	var benchmarks []*Benchmark
+	byName := map[string]*Benchmark{}
+	pkg := ""
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "pkg: ") {
+			pkg = strings.TrimSpace(strings.TrimPrefix(line, "pkg: "))
+			continue
+		}
+		// BenchmarkName-8   1000000   1234 ns/op   100 B/op   2 allocs/op
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") || len(fields)%2 != 0 {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+
+		b, present := byName[pkg+" "+fields[0]]
+		if !present {
+			b = &Benchmark{Package: pkg, Name: fields[0], Samples: map[string][]float64{}}
+			byName[pkg+" "+fields[0]] = b
+			benchmarks = append(benchmarks, b)
+		}
+		for i := 2; i+1 < len(fields); i += 2 {
+			val, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				continue
+			}
+			b.Samples[fields[i+1]] = append(b.Samples[fields[i+1]], val)
+		}
+	}
+	return benchmarks, scanner.Err()
+}
+
+// ReadBenchmarks reads a file holding the output of go test -bench
+func ReadBenchmarks(filename string) ([]*Benchmark, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseBenchmarks(f)
+}
+
+// RunBenchmarks runs go test -bench with the flags on the packages in workdir, writing
+// its output into filename, and returns the benchmarks. The file is removed if go
+// test fails, its output being printed.
+func (c *MageLibrary) RunBenchmarks(filename string, flags, pkgs []string) ([]*Benchmark, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// tests are not run, only benchmarks
+	args := append(append([]string{"test", "-run=^$"}, flags...), pkgs...)
+	cmd := c.env.CommandIn(c.workdir, c.env.GoCmd(), args...)
+	cmd.Stdout = f
+	if c.env.Verbose() {
+		cmd.Stdout = io.MultiWriter(f, os.Stdout)
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if !c.env.Verbose() {
+			if _, err := f.Seek(0, io.SeekStart); err == nil {
+				io.Copy(os.Stdout, f)
+			}
+		}
+		f.Close()
+		os.Remove(filename)
+		return nil, fmt.Errorf("error running benchmarks: %v", err)
+	}
+	util.Logf("Benchmark results written into %s", filename)
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return ParseBenchmarks(f)
+}
+
+// Summarize returns the statistics of the samples of the benchmark in the unit
+func (b *Benchmark) Summarize(unit string) BenchSummary {
+	samples := withoutOutliers(b.Samples[unit])
+	if len(samples) == 0 {
+		return BenchSummary{}
+	}
+
+	s := BenchSummary{Median: median(samples), N: len(samples)}
+	if s.Median != 0 {
+		for _, v := range samples {
+			s.Spread = math.Max(s.Spread, 100*math.Abs(v-s.Median)/s.Median)
+		}
+	}
+	return s
+}
+
+// CompareBenchmarks compares the benchmarks found in both the baseline and the new
+// results, in every unit, as benchstat does: outliers are excluded, medians are
+// compared and the significance of the change is given by a Mann-Whitney U-test
+func CompareBenchmarks(baseline, results []*Benchmark) []BenchDelta {
+	oldByName := map[string]*Benchmark{}
+	for _, b := range baseline {
+		oldByName[b.Package+" "+b.Name] = b
+	}
+
+	var deltas []BenchDelta
+	for _, nb := range results {
+		ob, present := oldByName[nb.Package+" "+nb.Name]
+		if !present {
+			continue
+		}
+		units := make([]string, 0, len(nb.Samples))
+		for unit := range nb.Samples {
+			if _, present := ob.Samples[unit]; present {
+				units = append(units, unit)
+			}
+		}
+		sort.Strings(units)
+
+		for _, unit := range units {
+			d := BenchDelta{Package: nb.Package, Name: nb.Name, Unit: unit, Old: ob.Summarize(unit), New: nb.Summarize(unit)}
+			if d.Old.Median != 0 {
+				d.Change = 100 * (d.New.Median - d.Old.Median) / d.Old.Median
+				if higherIsBetter(unit) {
+					d.Change = -d.Change
+				}
+			}
+			d.P = mannWhitneyU(withoutOutliers(ob.Samples[unit]), withoutOutliers(nb.Samples[unit]))
+			deltas = append(deltas, d)
+		}
+	}
+	return deltas
+}
+
+// higherIsBetter reports whether higher values of the unit are better (throughputs
+// such as MB/s), lower being better for the others (ns/op, B/op, allocs/op...)
+func higherIsBetter(unit string) bool {
+	return strings.HasSuffix(unit, "/s")
+}
+
+func median(sorted []float64) float64 {
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// withoutOutliers returns the sorted samples, excluding the ones further than 1.5
+// interquartile range from the quartiles (the medians of the lower and upper halves,
+// both including the median of an odd number of samples)
+func withoutOutliers(samples []float64) []float64 {
+	sorted := append([]float64{}, samples...)
+	sort.Float64s(sorted)
+	if len(sorted) < 4 {
+		return sorted
+	}
+
+	q1, q3 := median(sorted[:(len(sorted)+1)/2]), median(sorted[len(sorted)/2:])
+	low, high := q1-1.5*(q3-q1), q3+1.5*(q3-q1)
+	var kept []float64
+	for _, v := range sorted {
+		if v >= low && v <= high {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// mannWhitneyU returns the two-sided p-value of the Mann-Whitney U-test of the
+// samples: exact without ties, from the normal approximation otherwise
+func mannWhitneyU(x, y []float64) float64 {
+	n1, n2 := len(x), len(y)
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+
+	// ranks of the merged samples, ties getting their average rank
+	type value struct {
+		v     float64
+		fromX bool
+	}
+	all := make([]value, 0, n1+n2)
+	for _, v := range x {
+		all = append(all, value{v, true})
+	}
+	for _, v := range y {
+		all = append(all, value{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+
+	rankSumX, tieCorrection, ties := 0.0, 0.0, false
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // ranks i+1..j
+		for k := i; k < j; k++ {
+			if all[k].fromX {
+				rankSumX += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			ties = true
+			tieCorrection += t*t*t - t
+		}
+		i = j
+	}
+	u := rankSumX - float64(n1*(n1+1))/2
+	mean := float64(n1*n2) / 2
+	u = math.Min(u, float64(n1*n2)-u)
+
+	if !ties && n1+n2 <= 50 {
+		// exact distribution: number of orderings with a U statistic of k
+		counts := uCounts(n1, n2)
+		total, below := 0.0, 0.0
+		for k, c := range counts {
+			total += c
+			if float64(k) <= u {
+				below += c
+			}
+		}
+		return math.Min(1, 2*below/total)
+	}
+
+	n := float64(n1 + n2)
+	variance := float64(n1*n2) / 12 * ((n + 1) - tieCorrection/(n*(n-1)))
+	if variance <= 0 {
+		return 1
+	}
+	z := (u - mean + 0.5) / math.Sqrt(variance) // continuity correction
+	return math.Min(1, math.Erfc(-z/math.Sqrt2))
+}
+
+// uCounts returns the number of orderings of n1 and n2 values having each U
+// statistic, from 0 to n1*n2
+func uCounts(n1, n2 int) []float64 {
+	// counts[i][j][k] = counts[i-1][j][k-j] + counts[i][j-1][k]
+	prev := make([][]float64, n2+1)
+	for j := range prev {
+		prev[j] = []float64{1}
+	}
+	for i := 1; i <= n1; i++ {
+		cur := make([][]float64, n2+1)
+		cur[0] = []float64{1}
+		for j := 1; j <= n2; j++ {
+			cur[j] = make([]float64, i*j+1)
+			for k := range cur[j] {
+				if k-j >= 0 && k-j < len(prev[j]) {
+					cur[j][k] += prev[j][k-j]
+				}
+				if k < len(cur[j-1]) {
+					cur[j][k] += cur[j-1][k]
+				}
+			}
+		}
+		prev = cur
+	}
+	return prev[n2]
+}
@@ -0,0 +1,133 @@
+package mgl
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const benchOutput = `goos: linux
+goarch: amd64
+pkg: example.com/m/codec
+cpu: Intel(R) Core(TM) i7-8650U CPU @ 1.90GHz
+BenchmarkEncode/small-8   	 1000000	      1000 ns/op	  64.00 MB/s	     128 B/op	       2 allocs/op
+BenchmarkEncode/small-8   	 1000000	      1100 ns/op	  58.18 MB/s	     128 B/op	       2 allocs/op
+BenchmarkDecode-8         	  500000	      2500 ns/op
+--- BENCH: BenchmarkDecode-8
+    codec_test.go:42: not a result line 1 ns/op
+PASS
+ok  	example.com/m/codec	3.210s
+pkg: example.com/m/store
+BenchmarkDecode-8         	     100	    900000 ns/op
+PASS
+`
+
+func TestParseBenchmarks(t *testing.T) {
+	got, err := ParseBenchmarks(strings.NewReader(benchOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Benchmark{
+		{Package: "example.com/m/codec", Name: "BenchmarkEncode/small-8", Samples: map[string][]float64{
+			"ns/op": {1000, 1100}, "MB/s": {64, 58.18}, "B/op": {128, 128}, "allocs/op": {2, 2}}},
+		{Package: "example.com/m/codec", Name: "BenchmarkDecode-8", Samples: map[string][]float64{"ns/op": {2500}}},
+		{Package: "example.com/m/store", Name: "BenchmarkDecode-8", Samples: map[string][]float64{"ns/op": {900000}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseBenchmarks() = %+v, want %+v", got, want)
+	}
+}
+
+func TestWithoutOutliers(t *testing.T) {
+	tests := []struct {
+		samples []float64
+		want    []float64
+	}{
+		{nil, []float64{}},
+		{[]float64{3, 1, 100}, []float64{1, 3, 100}}, // too few samples to find outliers
+		{[]float64{10, 11, 12, 10, 50}, []float64{10, 10, 11, 12}},
+		{[]float64{100, 101, 99, 102, 98, 1, 200}, []float64{98, 99, 100, 101, 102}},
+		{[]float64{5, 5, 5, 5, 5}, []float64{5, 5, 5, 5, 5}},
+	}
+	for _, tt := range tests {
+		if got := withoutOutliers(tt.samples); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("withoutOutliers(%v) = %v, want %v", tt.samples, got, tt.want)
+		}
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	// p-values printed by benchstat for these samples
+	tests := []struct {
+		name string
+		x, y []float64
+		want float64
+	}{
+		{"3+3 separated", []float64{1, 2, 3}, []float64{4, 5, 6}, 0.100},
+		{"4+4 separated", []float64{1, 2, 3, 4}, []float64{5, 6, 7, 8}, 0.029},
+		{"5+5 separated", []float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 0.008},
+		{"5+5 reversed", []float64{6, 7, 8, 9, 10}, []float64{1, 2, 3, 4, 5}, 0.008},
+		{"5+5 one swap", []float64{1, 2, 3, 4, 6}, []float64{5, 7, 8, 9, 10}, 0.016},
+		{"5+5 interleaved", []float64{1, 3, 5, 7, 9}, []float64{2, 4, 6, 8, 10}, 0.690},
+		{"identical", []float64{5, 5, 5}, []float64{5, 5, 5}, 1},
+		{"separated with ties", []float64{1, 2, 2, 3}, []float64{4, 5, 5, 6}, 0.028}, // normal approximation
+		{"no sample", nil, []float64{1, 2}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mannWhitneyU(tt.x, tt.y); math.Abs(got-tt.want) > 0.0005 {
+				t.Errorf("mannWhitneyU() = %.4f, want %.3f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareBenchmarks(t *testing.T) {
+	baseline := []*Benchmark{
+		{Package: "m", Name: "BenchmarkA", Samples: map[string][]float64{
+			"ns/op": {100, 101, 102, 99, 98}, "MB/s": {10, 10, 10, 10, 10}, "B/op": {64, 64, 64, 64, 64}}},
+		{Package: "m", Name: "BenchmarkRemoved", Samples: map[string][]float64{"ns/op": {1}}},
+	}
+	results := []*Benchmark{
+		{Package: "m", Name: "BenchmarkA", Samples: map[string][]float64{
+			"ns/op": {120, 121, 122, 119, 118, 500}, "MB/s": {8, 8, 8, 8, 8}, "allocs/op": {1}}},
+		{Package: "m", Name: "BenchmarkAdded", Samples: map[string][]float64{"ns/op": {1}}},
+	}
+
+	deltas := CompareBenchmarks(baseline, results)
+	if len(deltas) != 2 || deltas[0].Unit != "MB/s" || deltas[1].Unit != "ns/op" {
+		t.Fatalf("CompareBenchmarks() = %+v, want deltas of BenchmarkA in MB/s and ns/op", deltas)
+	}
+
+	throughput := deltas[0]
+	if throughput.Change != 20 {
+		t.Errorf("MB/s change = %v, want +20%% (worse as lower)", throughput.Change)
+	}
+
+	d := deltas[1]
+	if d.Old.Median != 100 || d.New.Median != 120 || d.New.N != 5 {
+		t.Errorf("ns/op summaries = %+v, %+v, want medians 100 and 120, outlier excluded", d.Old, d.New)
+	}
+	if d.Change != 20 || !d.Significant(0.05) || math.Abs(d.P-0.008) > 0.0005 {
+		t.Errorf("ns/op delta = %+v, want a significant +20%% change (p=0.008)", d)
+	}
+}
+
+func TestRunBenchmarksFailing(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":        "module example.com/bench\n\ngo 1.17\n",
+		"bench_test.go": "package bench\n\nimport \"testing\"\n\nfunc BenchmarkFail(b *testing.B) { b.Fatal(\"broken\") }\n",
+	})
+	filename := filepath.Join(dir, "build", "bench", "rev.txt")
+	lib := NewMageLibrary(dir, WithEnv(Env{"GOFLAGS": ""}))
+	if _, err := lib.RunBenchmarks(filename, []string{"-bench=.", "-count=1"}, []string{"./..."}); err == nil {
+		t.Fatal("RunBenchmarks() succeeded, want an error")
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("results file %s of failed benchmarks not removed", filename)
+	}
+}
@@ -0,0 +1,131 @@
+package mgl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+)
+
+// BuildInfoSchemaVersion is the version of the build-info.json schema
+const BuildInfoSchemaVersion = 1
+
+// BuildInfo holds information regarding a build, as written in build-info.json
+type BuildInfo struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	Workdir       string            `json:"workdir"`
+	Version       string            `json:"version"`
+	BuildDate     string            `json:"buildDate"`
+	GoVersion     string            `json:"goVersion"`
+	Targets       []string          `json:"targets"`
+	Git           BuildInfoGit      `json:"git"`
+	Artifact      BuildInfoArtifact `json:"artifact"`
+	Docker        BuildInfoDocker   `json:"docker"`
+	Files         []BuildInfoFile   `json:"files"`
+}
+
+// BuildInfoGit holds information regarding git in build-info.json
+type BuildInfoGit struct {
+	Rev            string `json:"rev"`
+	TagAtRev       string `json:"tagAtRev"`
+	LatestTag      string `json:"latestTag"`
+	RevAtLatestTag string `json:"revAtLatestTag"`
+}
+
+// BuildInfoArtifact holds information regarding artifacts registry in build-info.json
+type BuildInfoArtifact struct {
+	URL string `json:"url"`
+}
+
+// BuildInfoDocker holds information regarding docker in build-info.json
+type BuildInfoDocker struct {
+	Registry string `json:"registry"`
+	Image    string `json:"image"`
+}
+
+// BuildInfoFile holds information regarding a file produced by the build
+type BuildInfoFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+	Sha1   string `json:"sha1"`
+	Md5    string `json:"md5"`
+}
+
+// NewBuildInfo constructs a BuildInfo from git, artifacts registry and docker details
+func (c *MageLibrary) NewBuildInfo(art *ArtifactInfos, dck *DockerInfos) *BuildInfo {
+	info := &BuildInfo{SchemaVersion: BuildInfoSchemaVersion, Workdir: c.Workdir(), Version: c.Version(),
+		Targets: []string{}, Files: []BuildInfoFile{}}
+
+	if git, err := c.GitDetails(); err == nil {
+		info.Git = BuildInfoGit{
+			Rev:            git.Rev,
+			TagAtRev:       git.TagAtRev,
+			LatestTag:      git.LatestTag,
+			RevAtLatestTag: git.RevAtLatestTag,
+		}
+	}
+	if art != nil {
+		info.Artifact.URL = art.URL
+	}
+	if dck != nil {
+		info.Docker = BuildInfoDocker{Registry: dck.Registry, Image: dck.Image}
+	}
+	return info
+}
+
+// AddFile adds a file produced by the build, with its size and checksums, replacing
+// the file of the same name if any
+func (b *BuildInfo) AddFile(filename string) error {
+	details, err := util.GetFileDetails(filename)
+	if err != nil {
+		return err
+	}
+	for i, f := range b.Files {
+		if f.Name == filepath.Base(filename) {
+			b.Files = append(b.Files[:i], b.Files[i+1:]...)
+			break
+		}
+	}
+	b.Files = append(b.Files, BuildInfoFile{
+		Name:   filepath.Base(filename),
+		Size:   details.Size,
+		Sha256: details.Checksum.Sha256,
+		Sha1:   details.Checksum.Sha1,
+		Md5:    details.Checksum.Md5,
+	})
+	return nil
+}
+
+// JSON returns the indented JSON representation of the BuildInfo
+func (b *BuildInfo) JSON() (string, error) {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Write writes the BuildInfo as JSON into the file
+func (b *BuildInfo) Write(filename string) error {
+	return writeJSON(filename, b)
+}
+
+// LoadBuildInfo reads a build-info.json file
+func LoadBuildInfo(filename string) (*BuildInfo, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &BuildInfo{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, fmt.Errorf("invalid build info %s: %v", filename, err)
+	}
+	if info.SchemaVersion > BuildInfoSchemaVersion {
+		return nil, fmt.Errorf("build info %s has schema version %d, greater than supported %d", filename, info.SchemaVersion, BuildInfoSchemaVersion)
+	}
+	return info, nil
+}
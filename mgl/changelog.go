@@ -0,0 +1,252 @@
+package mgl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+)
+
+const (
+	// separators used to split git log output into commits and fields
+	recordSep = "\x1e"
+	fieldSep  = "\x1f"
+)
+
+// historyTokens converts git log history to tokens
+type historyTokens struct {
+	refNames      string
+	committerDate string
+	commitHash    string
+	authorName    string
+	authorEmail   string
+	subject       string
+	filesChanged  int
+	insertions    int
+	deletions     int
+}
+
+// releaseSection holds the commits belonging to one release of the ChangeLog
+type releaseSection struct {
+	version      string
+	date         string
+	commits      []*historyTokens
+	contributors []contributor
+}
+
+// contributor is an author of a release, identified by its (mailmapped) email
+type contributor struct {
+	name      string
+	email     string
+	firstTime bool
+}
+
+var (
+	releaseTag = regexp.MustCompile(`^.*tag: (v[0-9]+\.[0-9]+\.[0-9]+).*$`)
+	statFiles  = regexp.MustCompile(`([0-9]+) files? changed`)
+	statIns    = regexp.MustCompile(`([0-9]+) insertions?\(\+\)`)
+	statDel    = regexp.MustCompile(`([0-9]+) deletions?\(-\)`)
+)
+
+// ChangeLog generates a ChangeLog based on git history.
+//
+// Commits are attributed to their author (honoring .mailmap) and each release
+// lists its contributors, highlighting the first time ones. Statistics per
+// release are added if MAGEFILEP_CHANGELOG_STATS is set to "yes" (see WithChangeLogStats).
+func (c *MageLibrary) ChangeLog(version, filename string, artifactURL, gitURL string) error {
+	gitDir := filepath.Join(c.Workdir(), ".git")
+	mailmap := "mailmap.file=" + filepath.Join(c.Workdir(), ".mailmap")
+	format := "--pretty=tformat:" + recordSep + strings.Join([]string{"%d", "%ci", "%h", "%aN", "%aE", "%s"}, fieldSep)
+	out, err := c.env.ExecOutput(c.env.GitCmd(), "-c", mailmap, "--git-dir", gitDir, "log", "--use-mailmap", "--shortstat", format)
+	if err != nil {
+		return err
+	}
+
+	keepMerge := c.MergeCommits()
+	withStats := c.ChangeLogStats()
+
+	current := &releaseSection{version: version, date: time.Now().Format("2006-01-02 15:04:05 -0700")}
+	sections := []*releaseSection{current}
+
+	for _, record := range strings.Split(out, recordSep) {
+		tokens := convertToTokens(record)
+		if tokens == nil {
+			continue
+		}
+		if releaseTag.MatchString(tokens.refNames) {
+			match := releaseTag.FindStringSubmatch(tokens.refNames)
+			current = &releaseSection{version: match[1], date: tokens.committerDate}
+			sections = append(sections, current)
+		}
+
+		if !keepMerge && isMergeCommit(tokens.subject) {
+			continue
+		}
+		current.commits = append(current.commits, tokens)
+	}
+
+	computeContributors(sections)
+
+	newfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer newfile.Close()
+
+	for _, section := range sections {
+		if _, err = newfile.WriteString(section.render(artifactURL, gitURL, withStats)); err != nil {
+			return err
+		}
+	}
+
+	util.AlwaysLogf("File %s generated", newfile.Name())
+	return nil
+}
+
+// MergeCommits reports whether merge commits are kept in ChangeLog,
+// MAGEFILEP_MERGE_COMMIT taking precedence over WithMergeCommits
+func (c *MageLibrary) MergeCommits() bool {
+	return c.envBool("MAGEFILEP_MERGE_COMMIT", c.mergeCommits)
+}
+
+// ChangeLogStats reports whether statistics per release are added in ChangeLog,
+// MAGEFILEP_CHANGELOG_STATS taking precedence over WithChangeLogStats
+func (c *MageLibrary) ChangeLogStats() bool {
+	return c.envBool("MAGEFILEP_CHANGELOG_STATS", c.clStats)
+}
+
+// envBool returns whether the variable is set to "yes", or def if not set
+func (c *MageLibrary) envBool(key string, def bool) bool {
+	if val, present := c.env.Lookup(key); present {
+		return val == "yes"
+	}
+	return def
+}
+
+func isMergeCommit(subject string) bool {
+	return strings.Contains(subject, "Merge branch") && strings.Contains(subject, "into")
+}
+
+// computeContributors fills contributors of every section, walking from the
+// oldest release to the newest one to detect first time contributors. Authors are
+// identified by their mailmapped email: a .mailmap entry is needed to gather the
+// commits of a person using several emails.
+func computeContributors(sections []*releaseSection) {
+	known := map[string]bool{}
+	for i := len(sections) - 1; i >= 0; i-- {
+		section := sections[i]
+
+		seen := map[string]bool{}
+		// commits are listed from newest to oldest
+		for j := len(section.commits) - 1; j >= 0; j-- {
+			commit := section.commits[j]
+			key := commit.contributorKey()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			section.contributors = append(section.contributors,
+				contributor{name: commit.authorName, email: commit.authorEmail, firstTime: !known[key]})
+		}
+		for key := range seen {
+			known[key] = true
+		}
+	}
+}
+
+func (s *releaseSection) render(artifactURL, gitURL string, withStats bool) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("\n## Release [%s](%s/%s) (%s)\n\n", s.version, artifactURL, s.version, s.date))
+
+	files, ins, del := 0, 0, 0
+	for _, commit := range s.commits {
+		sb.WriteString(fmt.Sprintf("* [%s](%s/commit/%s) - %s (%s)\n", commit.commitHash, gitURL, commit.commitHash, commit.subject, commit.authorName))
+		files += commit.filesChanged
+		ins += commit.insertions
+		del += commit.deletions
+	}
+
+	if len(s.contributors) > 0 {
+		sb.WriteString("\n### Contributors\n\n")
+		for _, line := range s.contributorLines() {
+			sb.WriteString(line)
+		}
+	}
+
+	if withStats && len(s.commits) > 0 {
+		sb.WriteString("\n### Statistics\n\n")
+		sb.WriteString(fmt.Sprintf("%d commits, %d files changed, %d insertions(+), %d deletions(-)\n", len(s.commits), files, ins, del))
+	}
+
+	return sb.String()
+}
+
+// contributorLines returns the lines listing the contributors, by name, adding the
+// email of the ones sharing their name with another contributor
+func (s *releaseSection) contributorLines() []string {
+	names := map[string]int{}
+	for _, c := range s.contributors {
+		names[c.name]++
+	}
+
+	var lines []string
+	for _, c := range s.contributors {
+		label := c.name
+		if names[c.name] > 1 && c.email != "" {
+			label = fmt.Sprintf("%s <%s>", c.name, c.email)
+		}
+		if c.firstTime {
+			label += " (first contribution)"
+		}
+		lines = append(lines, "* "+label+"\n")
+	}
+	return lines
+}
+
+// contributorKey identifies an author, using the (mailmapped) email when known
+func (h *historyTokens) contributorKey() string {
+	if h.authorEmail != "" {
+		return strings.ToLower(h.authorEmail)
+	}
+	return h.authorName
+}
+
+func convertToTokens(record string) *historyTokens {
+	lines := strings.Split(strings.TrimSpace(record), "\n")
+	tokens := strings.Split(lines[0], fieldSep)
+	if len(tokens) < 6 {
+		return nil
+	}
+	history := historyTokens{}
+	history.refNames = util.TrimString(tokens[0])
+	history.committerDate = util.TrimString(tokens[1])
+	history.commitHash = util.TrimString(tokens[2])
+	history.authorName = util.TrimString(tokens[3])
+	history.authorEmail = util.TrimString(tokens[4])
+	history.subject = util.TrimString(tokens[5])
+
+	// remaining non empty line, if any, is the --shortstat summary
+	for _, line := range lines[1:] {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		history.filesChanged = statValue(statFiles, line)
+		history.insertions = statValue(statIns, line)
+		history.deletions = statValue(statDel, line)
+	}
+	return &history
+}
+
+func statValue(re *regexp.Regexp, line string) int {
+	match := re.FindStringSubmatch(line)
+	if match == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(match[1])
+	return n
+}
@@ -0,0 +1,110 @@
+package mgl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func record(fields ...string) string {
+	return strings.Join(fields, fieldSep)
+}
+
+func TestConvertToTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		record string
+		want   *historyTokens
+	}{
+		{
+			name:   "commit without stats",
+			record: record(" (HEAD -> master, tag: v1.2.0)", "2020-01-02 10:00:00 +0100", "abc1234", "Jane Doe", "jane@example.com", "Add feature"),
+			want: &historyTokens{refNames: "(HEAD -> master, tag: v1.2.0)", committerDate: "2020-01-02 10:00:00 +0100",
+				commitHash: "abc1234", authorName: "Jane Doe", authorEmail: "jane@example.com", subject: "Add feature"},
+		},
+		{
+			name: "commit with shortstat",
+			record: record("", "2020-01-02 10:00:00 +0100", "abc1234", "Jane Doe", "jane@example.com", "Fix bug") +
+				"\n\n 3 files changed, 10 insertions(+), 2 deletions(-)\n",
+			want: &historyTokens{committerDate: "2020-01-02 10:00:00 +0100", commitHash: "abc1234", authorName: "Jane Doe",
+				authorEmail: "jane@example.com", subject: "Fix bug", filesChanged: 3, insertions: 10, deletions: 2},
+		},
+		{
+			name:   "subject with separators of git log output",
+			record: record("", "2020-01-02", "abc1234", "Jane Doe", "jane@example.com", "Use a: b, c (d)"),
+			want: &historyTokens{committerDate: "2020-01-02", commitHash: "abc1234", authorName: "Jane Doe",
+				authorEmail: "jane@example.com", subject: "Use a: b, c (d)"},
+		},
+		{
+			name:   "incomplete record",
+			record: record("", "2020-01-02", "abc1234"),
+		},
+		{
+			name:   "empty record",
+			record: "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := convertToTokens(tt.record)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("convertToTokens() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShortStat(t *testing.T) {
+	tests := []struct {
+		line                       string
+		files, insertions, deletes int
+	}{
+		{" 1 file changed, 1 insertion(+)", 1, 1, 0},
+		{" 1 file changed, 1 deletion(-)", 1, 0, 1},
+		{" 12 files changed, 340 insertions(+), 56 deletions(-)", 12, 340, 56},
+		{" 2 files changed, 0 insertions(+), 0 deletions(-)", 2, 0, 0},
+		{"no stats", 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := statValue(statFiles, tt.line); got != tt.files {
+				t.Errorf("files changed = %d, want %d", got, tt.files)
+			}
+			if got := statValue(statIns, tt.line); got != tt.insertions {
+				t.Errorf("insertions = %d, want %d", got, tt.insertions)
+			}
+			if got := statValue(statDel, tt.line); got != tt.deletes {
+				t.Errorf("deletions = %d, want %d", got, tt.deletes)
+			}
+		})
+	}
+}
+
+func TestComputeContributors(t *testing.T) {
+	commit := func(name, email string) *historyTokens {
+		return &historyTokens{authorName: name, authorEmail: email}
+	}
+	// sections and commits from newest to oldest, as git log lists them
+	sections := []*releaseSection{
+		{version: "v1.1.0", commits: []*historyTokens{
+			commit("Jane Doe", "jane@other.com"),
+			commit("John Smith", "john@example.com"),
+			commit("Jane Doe", "JANE@example.com"),
+		}},
+		{version: "v1.0.0", commits: []*historyTokens{
+			commit("Jane Doe", "jane@example.com"),
+			commit("Jane Doe", "jane@example.com"),
+		}},
+	}
+	computeContributors(sections)
+
+	want := [][]string{
+		{"* Jane Doe <JANE@example.com>\n", "* John Smith (first contribution)\n", "* Jane Doe <jane@other.com> (first contribution)\n"},
+		{"* Jane Doe (first contribution)\n"},
+	}
+	for i, section := range sections {
+		if got := section.contributorLines(); !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("contributors of %s = %q, want %q", section.version, got, want[i])
+		}
+	}
+}
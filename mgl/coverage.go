@@ -0,0 +1,309 @@
+package mgl
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CoverBlock holds a block of statements of a cover profile
+type CoverBlock struct {
+	File      string // import path of the package / file name
+	StartLine int
+	StartCol  int
+	EndLine   int
+	EndCol    int
+	NumStmt   int
+	Count     int
+}
+
+// CoverProfile holds a cover profile, as written by go test -coverprofile
+type CoverProfile struct {
+	Mode   string // set, count or atomic
+	Blocks []CoverBlock
+}
+
+// CoverageSummary holds the statements coverage of a package
+type CoverageSummary struct {
+	Package    string
+	Statements int
+	Covered    int
+}
+
+// Percent returns the percentage of statements covered (100 if none)
+func (s CoverageSummary) Percent() float64 {
+	if s.Statements == 0 {
+		return 100
+	}
+	return 100 * float64(s.Covered) / float64(s.Statements)
+}
+
+// ReadCoverProfile reads a cover profile, merging the blocks given several times
+// (e.g. by several test binaries with -coverpkg)
+func ReadCoverProfile(filename string) (*CoverProfile, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	profile := &CoverProfile{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "mode: ") {
+			profile.Mode = strings.TrimPrefix(line, "mode: ")
+			continue
+		}
+		// file:startLine.startCol,endLine.endCol numStmt count
+		var b CoverBlock
+		i := strings.LastIndex(line, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("%s:%d: invalid cover block %q", filename, n, line)
+		}
+		b.File = line[:i]
+		if _, err := fmt.Sscanf(line[i+1:], "%d.%d,%d.%d %d %d",
+			&b.StartLine, &b.StartCol, &b.EndLine, &b.EndCol, &b.NumStmt, &b.Count); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid cover block %q", filename, n, line)
+		}
+		profile.Blocks = append(profile.Blocks, b)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if profile.Mode == "" {
+		return nil, fmt.Errorf("%s: no mode line, not a cover profile", filename)
+	}
+	return MergeCoverProfiles(profile)
+}
+
+// MergeCoverProfiles merges cover profiles of the same mode, adding the counts of
+// the blocks found in several profiles (set mode keeping whether they are covered)
+func MergeCoverProfiles(profiles ...*CoverProfile) (*CoverProfile, error) {
+	merged := &CoverProfile{}
+	index := map[CoverBlock]int{}
+	for _, p := range profiles {
+		if merged.Mode == "" {
+			merged.Mode = p.Mode
+		} else if p.Mode != merged.Mode {
+			return nil, fmt.Errorf("unable to merge cover profiles of modes %s and %s", merged.Mode, p.Mode)
+		}
+		for _, b := range p.Blocks {
+			key := b
+			key.Count = 0
+			i, present := index[key]
+			if !present {
+				index[key] = len(merged.Blocks)
+				merged.Blocks = append(merged.Blocks, b)
+				continue
+			}
+			if merged.Mode == "set" {
+				if b.Count > 0 {
+					merged.Blocks[i].Count = 1
+				}
+			} else {
+				merged.Blocks[i].Count += b.Count
+			}
+		}
+	}
+
+	sort.SliceStable(merged.Blocks, func(i, j int) bool {
+		bi, bj := merged.Blocks[i], merged.Blocks[j]
+		if bi.File != bj.File {
+			return bi.File < bj.File
+		}
+		if bi.StartLine != bj.StartLine {
+			return bi.StartLine < bj.StartLine
+		}
+		return bi.StartCol < bj.StartCol
+	})
+	return merged, nil
+}
+
+// Write writes the cover profile in the format of go test -coverprofile
+func (p *CoverProfile) Write(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "mode: %s\n", p.Mode)
+	for _, b := range p.Blocks {
+		fmt.Fprintf(w, "%s:%d.%d,%d.%d %d %d\n", b.File, b.StartLine, b.StartCol, b.EndLine, b.EndCol, b.NumStmt, b.Count)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Packages returns the statements coverage of each package of the profile
+func (p *CoverProfile) Packages() []CoverageSummary {
+	byPkg := map[string]*CoverageSummary{}
+	var result []*CoverageSummary
+	for _, b := range p.Blocks {
+		pkg := path.Dir(b.File)
+		s, present := byPkg[pkg]
+		if !present {
+			s = &CoverageSummary{Package: pkg}
+			byPkg[pkg] = s
+			result = append(result, s)
+		}
+		s.Statements += b.NumStmt
+		if b.Count > 0 {
+			s.Covered += b.NumStmt
+		}
+	}
+
+	summaries := make([]CoverageSummary, 0, len(result))
+	for _, s := range result {
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Package < summaries[j].Package })
+	return summaries
+}
+
+// Total returns the statements coverage of all the packages of the profile
+func (p *CoverProfile) Total() CoverageSummary {
+	total := CoverageSummary{Package: "total"}
+	for _, s := range p.Packages() {
+		total.Statements += s.Statements
+		total.Covered += s.Covered
+	}
+	return total
+}
+
+// CoverageHTML writes the HTML report of a cover profile file via go tool cover
+func (c *MageLibrary) CoverageHTML(profile, filename string) error {
+	if err := c.env.RunCmdIn(c.workdir, c.env.GoCmd(), "tool", "cover", "-html="+profile, "-o", filename); err != nil {
+		return fmt.Errorf("error running go tool cover: %v", err)
+	}
+	return nil
+}
+
+// WriteCobertura writes a cover profile as a Cobertura XML report, with a class per
+// file, named relative to workdir for the files of its packages
+func (c *MageLibrary) WriteCobertura(filename string, profile *CoverProfile) error {
+	type line struct {
+		Number int `xml:"number,attr"`
+		Hits   int `xml:"hits,attr"`
+	}
+	type class struct {
+		Name       string   `xml:"name,attr"`
+		Filename   string   `xml:"filename,attr"`
+		LineRate   string   `xml:"line-rate,attr"`
+		BranchRate string   `xml:"branch-rate,attr"`
+		Complexity string   `xml:"complexity,attr"`
+		Methods    struct{} `xml:"methods"`
+		Lines      []line   `xml:"lines>line"`
+	}
+	type pkg struct {
+		Name       string   `xml:"name,attr"`
+		LineRate   string   `xml:"line-rate,attr"`
+		BranchRate string   `xml:"branch-rate,attr"`
+		Complexity string   `xml:"complexity,attr"`
+		Classes    []*class `xml:"classes>class"`
+	}
+	type coverage struct {
+		XMLName         xml.Name `xml:"coverage"`
+		LineRate        string   `xml:"line-rate,attr"`
+		BranchRate      string   `xml:"branch-rate,attr"`
+		LinesCovered    int      `xml:"lines-covered,attr"`
+		LinesValid      int      `xml:"lines-valid,attr"`
+		BranchesCovered int      `xml:"branches-covered,attr"`
+		BranchesValid   int      `xml:"branches-valid,attr"`
+		Complexity      string   `xml:"complexity,attr"`
+		Version         string   `xml:"version,attr"`
+		Timestamp       int64    `xml:"timestamp,attr"`
+		Sources         []string `xml:"sources>source"`
+		Packages        []*pkg   `xml:"packages>package"`
+	}
+
+	rate := func(covered, valid int) string {
+		if valid == 0 {
+			return "1"
+		}
+		return strconv.FormatFloat(float64(covered)/float64(valid), 'f', 4, 64)
+	}
+
+	workdir, err := filepath.Abs(c.workdir)
+	if err != nil {
+		return err
+	}
+	dirs := map[string]string{}
+	if pkgs, err := c.PackageDetails(); err == nil {
+		for _, p := range pkgs.Packages {
+			dirs[p.ImportPath] = filepath.ToSlash(filepath.Clean(p.RelDir))
+		}
+	}
+
+	// hits per line of each file, a line being covered if all its blocks are
+	hits := map[string]map[int]int{}
+	var files []string
+	for _, b := range profile.Blocks {
+		lines, present := hits[b.File]
+		if !present {
+			lines = map[int]int{}
+			hits[b.File] = lines
+			files = append(files, b.File)
+		}
+		for l := b.StartLine; l <= b.EndLine; l++ {
+			if h, seen := lines[l]; !seen || b.Count < h {
+				lines[l] = b.Count
+			}
+		}
+	}
+	sort.Strings(files)
+
+	doc := coverage{BranchRate: "0", Complexity: "0", Version: "mageproj", Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+		Sources: []string{workdir}}
+	pkgs := map[string]*pkg{}
+	covered := map[*pkg][2]int{}
+	for _, file := range files {
+		importPath := path.Dir(file)
+		p, present := pkgs[importPath]
+		if !present {
+			p = &pkg{Name: importPath, BranchRate: "0", Complexity: "0"}
+			pkgs[importPath] = p
+			doc.Packages = append(doc.Packages, p)
+		}
+
+		name := file
+		if dir, known := dirs[importPath]; known {
+			name = path.Join(dir, path.Base(file))
+		}
+		cl := &class{Name: path.Base(file), Filename: name, BranchRate: "0", Complexity: "0"}
+		classCovered := 0
+		for number, h := range hits[file] {
+			cl.Lines = append(cl.Lines, line{number, h})
+			if h > 0 {
+				classCovered++
+			}
+		}
+		sort.Slice(cl.Lines, func(i, j int) bool { return cl.Lines[i].Number < cl.Lines[j].Number })
+		cl.LineRate = rate(classCovered, len(cl.Lines))
+		p.Classes = append(p.Classes, cl)
+
+		counts := covered[p]
+		covered[p] = [2]int{counts[0] + classCovered, counts[1] + len(cl.Lines)}
+		doc.LinesCovered += classCovered
+		doc.LinesValid += len(cl.Lines)
+	}
+	for _, p := range doc.Packages {
+		p.LineRate = rate(covered[p][0], covered[p][1])
+	}
+	doc.LineRate = rate(doc.LinesCovered, doc.LinesValid)
+
+	return writeXML(filename, doc)
+}
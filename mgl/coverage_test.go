@@ -0,0 +1,151 @@
+package mgl
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func block(file string, start, end, stmts, count int) CoverBlock {
+	return CoverBlock{File: file, StartLine: start, StartCol: 2, EndLine: end, EndCol: 3, NumStmt: stmts, Count: count}
+}
+
+func TestMergeCoverProfiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		profiles []*CoverProfile
+		want     *CoverProfile
+	}{
+		{
+			name: "count mode adds counts of the same block",
+			profiles: []*CoverProfile{
+				{Mode: "count", Blocks: []CoverBlock{block("m/a.go", 10, 12, 2, 1), block("m/a.go", 3, 5, 1, 0)}},
+				{Mode: "count", Blocks: []CoverBlock{block("m/a.go", 10, 12, 2, 4), block("m/b.go", 1, 2, 1, 1)}},
+			},
+			want: &CoverProfile{Mode: "count", Blocks: []CoverBlock{
+				block("m/a.go", 3, 5, 1, 0), block("m/a.go", 10, 12, 2, 5), block("m/b.go", 1, 2, 1, 1)}},
+		},
+		{
+			name: "set mode keeps blocks covered once",
+			profiles: []*CoverProfile{
+				{Mode: "set", Blocks: []CoverBlock{block("m/a.go", 3, 5, 1, 1), block("m/a.go", 6, 8, 1, 0)}},
+				{Mode: "set", Blocks: []CoverBlock{block("m/a.go", 3, 5, 1, 1), block("m/a.go", 6, 8, 1, 1)}},
+			},
+			want: &CoverProfile{Mode: "set", Blocks: []CoverBlock{block("m/a.go", 3, 5, 1, 1), block("m/a.go", 6, 8, 1, 1)}},
+		},
+		{
+			name: "overlapping blocks of different ranges are kept apart",
+			profiles: []*CoverProfile{
+				{Mode: "atomic", Blocks: []CoverBlock{block("m/a.go", 3, 9, 3, 2)}},
+				{Mode: "atomic", Blocks: []CoverBlock{block("m/a.go", 3, 5, 1, 1)}},
+			},
+			want: &CoverProfile{Mode: "atomic", Blocks: []CoverBlock{block("m/a.go", 3, 9, 3, 2), block("m/a.go", 3, 5, 1, 1)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergeCoverProfiles(tt.profiles...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeCoverProfiles() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeCoverProfilesModes(t *testing.T) {
+	_, err := MergeCoverProfiles(&CoverProfile{Mode: "set"}, &CoverProfile{Mode: "atomic"})
+	if err == nil || !strings.Contains(err.Error(), "modes set and atomic") {
+		t.Errorf("MergeCoverProfiles() = %v, want an error about the modes", err)
+	}
+}
+
+func TestReadCoverProfile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "unit.out")
+	content := "mode: atomic\nm/a.go:3.2,5.3 1 1\nm/a.go:3.2,5.3 1 2\nm/p/b.go:1.2,2.3 4 0\n"
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadCoverProfile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &CoverProfile{Mode: "atomic", Blocks: []CoverBlock{block("m/a.go", 3, 5, 1, 3), block("m/p/b.go", 1, 2, 4, 0)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadCoverProfile() = %+v, want %+v", got, want)
+	}
+	if total := got.Total(); total.Statements != 5 || total.Covered != 1 || total.Percent() != 20 {
+		t.Errorf("Total() = %+v, want 1 of 5 statements", total)
+	}
+
+	if err := ioutil.WriteFile(filename, []byte("m/a.go:3.2,5.3 1 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadCoverProfile(filename); err == nil {
+		t.Error("ReadCoverProfile() of a profile without mode succeeded")
+	}
+}
+
+func TestWriteCobertura(t *testing.T) {
+	dir := t.TempDir()
+	profile := &CoverProfile{Mode: "count", Blocks: []CoverBlock{
+		block("m/a.go", 1, 2, 2, 3),
+		block("m/a.go", 2, 3, 1, 0), // line 2 shared with a covered block is not covered
+		block("m/p/b.go", 5, 5, 1, 1),
+	}}
+	filename := filepath.Join(dir, "coverage.xml")
+	if err := NewMageLibrary(dir).WriteCobertura(filename, profile); err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		LineRate     string `xml:"line-rate,attr"`
+		LinesCovered int    `xml:"lines-covered,attr"`
+		LinesValid   int    `xml:"lines-valid,attr"`
+		Packages     []struct {
+			Name     string `xml:"name,attr"`
+			LineRate string `xml:"line-rate,attr"`
+			Classes  []struct {
+				Name     string `xml:"name,attr"`
+				Filename string `xml:"filename,attr"`
+				Lines    []struct {
+					Number int `xml:"number,attr"`
+					Hits   int `xml:"hits,attr"`
+				} `xml:"lines>line"`
+			} `xml:"classes>class"`
+		} `xml:"packages>package"`
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xml.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.LinesCovered != 2 || got.LinesValid != 4 || got.LineRate != "0.5000" {
+		t.Errorf("coverage = %d/%d lines (rate %s), want 2/4 (rate 0.5000)", got.LinesCovered, got.LinesValid, got.LineRate)
+	}
+	if len(got.Packages) != 2 || got.Packages[0].Name != "m" || got.Packages[1].Name != "m/p" {
+		t.Fatalf("packages = %+v, want m and m/p", got.Packages)
+	}
+	a := got.Packages[0]
+	if a.LineRate != "0.3333" || len(a.Classes) != 1 || a.Classes[0].Name != "a.go" || a.Classes[0].Filename != "m/a.go" {
+		t.Errorf("package m = %+v, want class a.go of rate 0.3333", a)
+	}
+	hits := map[int]int{}
+	for _, l := range a.Classes[0].Lines {
+		hits[l.Number] = l.Hits
+	}
+	if want := map[int]int{1: 3, 2: 0, 3: 0}; !reflect.DeepEqual(hits, want) {
+		t.Errorf("hits of a.go = %v, want %v", hits, want)
+	}
+	if b := got.Packages[1]; b.LineRate != "1.0000" || len(b.Classes) != 1 || b.Classes[0].Filename != "m/p/b.go" {
+		t.Errorf("package m/p = %+v, want class b.go of rate 1.0000", b)
+	}
+}
@@ -0,0 +1,241 @@
+package mgl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+)
+
+// DockerTagPolicy defines which tags are given to a Docker image
+type DockerTagPolicy struct {
+	GitTag bool     // the git tag at current revision as is (e.g. v1.2.3)
+	SemVer bool     // the SemVer tags 1, 1.2 and 1.2.3 (only 1.2.3-rc.1 for pre-releases)
+	GitRev bool     // the git short SHA
+	Branch bool     // the branch name for non-release builds
+	Latest bool     // latest, if the version is not older than the greatest one
+	Static []string // custom static tags
+}
+
+// DefaultDockerTagPolicy tags with the git tag and latest
+func DefaultDockerTagPolicy() DockerTagPolicy {
+	return DockerTagPolicy{GitTag: true, Latest: true}
+}
+
+// DockerTagDetails holds the tags computed from a DockerTagPolicy
+type DockerTagDetails struct {
+	Tags   []string
+	Latest bool
+	Reason string // why latest is not moved, if so
+}
+
+var invalidTagChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// DockerTags computes the tags to give to the Docker image at current revision
+func (c *MageLibrary) DockerTags(policy DockerTagPolicy) (*DockerTagDetails, error) {
+	git, err := c.GitDetails()
+	if err != nil {
+		return nil, err
+	}
+
+	details := &DockerTagDetails{}
+	add := func(tag string) {
+		for _, t := range details.Tags {
+			if t == tag {
+				return
+			}
+		}
+		details.Tags = append(details.Tags, tag)
+	}
+
+	version, isSemVer := util.ParseSemVer(git.TagAtRev)
+	release := git.TagAtRev != ""
+
+	if release && policy.GitTag {
+		add(sanitizeDockerTag(git.TagAtRev))
+	}
+	if release && isSemVer && policy.SemVer {
+		// floating tags only move forward, within their own major or minor line
+		if version.PreRelease == "" {
+			greatest, err := c.greatestVersion(func(v util.SemVer) bool { return v.Major == version.Major })
+			if err != nil {
+				return nil, err
+			}
+			if version.Compare(greatest) >= 0 {
+				add(fmt.Sprintf("%d", version.Major))
+			}
+			greatest, err = c.greatestVersion(func(v util.SemVer) bool { return v.Major == version.Major && v.Minor == version.Minor })
+			if err != nil {
+				return nil, err
+			}
+			if version.Compare(greatest) >= 0 {
+				add(fmt.Sprintf("%d.%d", version.Major, version.Minor))
+			}
+		}
+		add(sanitizeDockerTag(version.String()))
+	}
+	if policy.GitRev && git.Rev != "" {
+		add(git.Rev)
+	}
+	if !release && policy.Branch && git.Branch != "" {
+		add(sanitizeDockerTag(git.Branch))
+	}
+	for _, tag := range policy.Static {
+		add(sanitizeDockerTag(tag))
+	}
+
+	if policy.Latest {
+		switch {
+		case !release:
+			details.Reason = "no git tag at current revision"
+		case !isSemVer:
+			details.Reason = fmt.Sprintf("git tag %s is not a SemVer", git.TagAtRev)
+		case version.PreRelease != "":
+			details.Reason = fmt.Sprintf("git tag %s is a pre-release", git.TagAtRev)
+		default:
+			greatest, err := c.greatestVersion(func(util.SemVer) bool { return true })
+			if err != nil {
+				return nil, err
+			}
+			if version.Compare(greatest) < 0 {
+				details.Reason = fmt.Sprintf("refusing to move latest backwards from %s to %s", greatest, version)
+			} else {
+				details.Latest = true
+			}
+		}
+	}
+
+	return details, nil
+}
+
+// greatestVersion returns the greatest released SemVer among the matching git tags
+func (c *MageLibrary) greatestVersion(match func(util.SemVer) bool) (util.SemVer, error) {
+	gitDir := filepath.Join(c.Workdir(), ".git")
+	out, err := c.env.ExecOutput(c.env.GitCmd(), "--git-dir", gitDir, "tag", "--list")
+	if err != nil {
+		return util.SemVer{}, err
+	}
+
+	var greatest util.SemVer
+	for _, tag := range strings.Split(out, "\n") {
+		v, ok := util.ParseSemVer(util.TrimString(tag))
+		if ok && v.PreRelease == "" && match(v) && v.Compare(greatest) > 0 {
+			greatest = v
+		}
+	}
+	return greatest, nil
+}
+
+// sanitizeDockerTag replaces the characters not allowed in a Docker tag
+func sanitizeDockerTag(tag string) string {
+	tag = invalidTagChars.ReplaceAllString(tag, "-")
+	tag = strings.TrimLeft(tag, ".-")
+	if len(tag) > 128 {
+		tag = tag[:128]
+	}
+	return tag
+}
+
+// DockerfileSpec describes a minimal Dockerfile running a prebuilt binary
+type DockerfileSpec struct {
+	BaseImage string // e.g. scratch or gcr.io/distroless/static
+	Binary    string // binary name, looked up in <TARGETOS>-<TARGETARCH> dir of the build context
+	AppPath   string // directory of the binary in the image
+	Title     string // org.opencontainers.image.title label
+	Source    string // org.opencontainers.image.source label
+	SBOM      bool   // copy sbom.cdx.json and sbom.spdx.json from the binary dir into /sbom
+}
+
+// GenerateDockerfile writes a Dockerfile copying the binary built for the target
+// platform. VERSION, BUILD_DATE and GIT_REV build args are set as OCI labels.
+func GenerateDockerfile(filename string, spec DockerfileSpec) error {
+	bin := filepath.ToSlash(filepath.Join(spec.AppPath, spec.Binary))
+
+	var sb strings.Builder
+	sb.WriteString("# Generated by mageproj, do not edit\n")
+	sb.WriteString(fmt.Sprintf("FROM %s\n", spec.BaseImage))
+	sb.WriteString("ARG TARGETOS\nARG TARGETARCH\nARG VERSION\nARG BUILD_DATE\nARG GIT_REV\n")
+	sb.WriteString(fmt.Sprintf("LABEL org.opencontainers.image.title=%q \\\n", spec.Title))
+	if spec.Source != "" {
+		sb.WriteString(fmt.Sprintf("      org.opencontainers.image.source=%q \\\n", spec.Source))
+	}
+	sb.WriteString("      org.opencontainers.image.version=\"${VERSION}\" \\\n")
+	sb.WriteString("      org.opencontainers.image.created=\"${BUILD_DATE}\" \\\n")
+	sb.WriteString("      org.opencontainers.image.revision=\"${GIT_REV}\"\n")
+	sb.WriteString(fmt.Sprintf("COPY ${TARGETOS}-${TARGETARCH}/%s %s\n", spec.Binary, bin))
+	if spec.SBOM {
+		sb.WriteString("COPY ${TARGETOS}-${TARGETARCH}/sbom.cdx.json ${TARGETOS}-${TARGETARCH}/sbom.spdx.json /sbom/\n")
+		sb.WriteString("LABEL io.mageproj.sbom.cyclonedx=\"/sbom/sbom.cdx.json\" \\\n")
+		sb.WriteString("      io.mageproj.sbom.spdx=\"/sbom/sbom.spdx.json\"\n")
+	}
+	sb.WriteString(fmt.Sprintf("ENTRYPOINT [%q]\n", bin))
+
+	return ioutil.WriteFile(filename, []byte(sb.String()), 0644)
+}
+
+// dockerConfig holds the part of the Docker client configuration regarding credentials
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth          string `json:"auth"`
+		IdentityToken string `json:"identitytoken"`
+	} `json:"auths"`
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+// DockerConfigHasCredentials reports whether the Docker client configuration
+// ($DOCKER_CONFIG/config.json or ~/.docker/config.json) provides credentials
+// for the registry, either stored or through a credential helper
+func DockerConfigHasCredentials(env Env, registry string) bool {
+	dir := env.Get("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return false
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	return configHasCredentials(filepath.Join(dir, "config.json"), registry)
+}
+
+// configHasCredentials reads a Docker like configuration file looking for
+// credentials for the registry
+func configHasCredentials(filename, registry string) bool {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return false
+	}
+	var cfg dockerConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return false
+	}
+
+	host := registryHost(registry)
+	for key, auth := range cfg.Auths {
+		if registryHost(key) == host && (auth.Auth != "" || auth.IdentityToken != "" || cfg.CredsStore != "") {
+			return true
+		}
+	}
+	for key := range cfg.CredHelpers {
+		if registryHost(key) == host {
+			return true
+		}
+	}
+	return false
+}
+
+// registryHost normalizes a registry to its host, Docker Hub being the default one
+func registryHost(registry string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://")
+	host = strings.SplitN(host, "/", 2)[0]
+	switch host {
+	case "", "docker.io", "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+	return host
+}
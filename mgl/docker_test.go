@@ -0,0 +1,122 @@
+package mgl
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+// gitEnv runs git commands of tests with a fixed identity and no user configuration
+var gitEnv = Env{"GIT_AUTHOR_NAME": "Jane Doe", "GIT_AUTHOR_EMAIL": "jane@example.com",
+	"GIT_COMMITTER_NAME": "Jane Doe", "GIT_COMMITTER_EMAIL": "jane@example.com",
+	"GIT_CONFIG_GLOBAL": "/dev/null", "GIT_CONFIG_NOSYSTEM": "1"}
+
+// gitRepo creates a git repository with a commit per tag, then a commit tagged
+// with head (if not empty), and returns its directory
+func gitRepo(t *testing.T, tags []string, head string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		if out, err := gitEnv.CommandIn(dir, "git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	for _, tag := range append(tags, head) {
+		git("commit", "-q", "--allow-empty", "-m", "commit "+tag)
+		if tag != "" {
+			git("tag", "-a", tag, "-m", tag)
+		}
+	}
+	return dir
+}
+
+func TestDockerTags(t *testing.T) {
+	all := DockerTagPolicy{GitTag: true, SemVer: true, GitRev: false, Branch: true, Latest: true, Static: []string{"stable"}}
+	tests := []struct {
+		name   string
+		tags   []string
+		head   string
+		policy DockerTagPolicy
+		want   []string
+		latest bool
+	}{
+		{
+			name:   "default policy on release",
+			tags:   []string{"v1.0.0"},
+			head:   "v1.1.0",
+			policy: DefaultDockerTagPolicy(),
+			want:   []string{"v1.1.0"},
+			latest: true,
+		},
+		{
+			name:   "floating tags of greatest release",
+			tags:   []string{"v1.0.0", "v1.1.0"},
+			head:   "v1.2.0",
+			policy: all,
+			want:   []string{"v1.2.0", "1", "1.2", "1.2.0", "stable"},
+			latest: true,
+		},
+		{
+			name:   "patch of an older minor line",
+			tags:   []string{"v1.1.0", "v1.2.0"},
+			head:   "v1.1.1",
+			policy: all,
+			want:   []string{"v1.1.1", "1.1", "1.1.1", "stable"},
+		},
+		{
+			name:   "patch of an older major line",
+			tags:   []string{"v1.1.0", "v2.0.0"},
+			head:   "v1.1.1",
+			policy: all,
+			want:   []string{"v1.1.1", "1", "1.1", "1.1.1", "stable"},
+		},
+		{
+			name:   "pre-release",
+			tags:   []string{"v1.0.0", "v1.1.0-rc.9"},
+			head:   "v1.1.0-rc.10",
+			policy: all,
+			want:   []string{"v1.1.0-rc.10", "1.1.0-rc.10", "stable"},
+		},
+		{
+			name:   "no git tag",
+			tags:   []string{"v1.0.0"},
+			policy: all,
+			want:   []string{"main", "stable"},
+		},
+		{
+			name:   "not a SemVer",
+			head:   "release/42",
+			policy: all,
+			want:   []string{"release-42", "stable"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lib := NewMageLibrary(gitRepo(t, tt.tags, tt.head))
+			got, err := lib.DockerTags(tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Tags, tt.want) || got.Latest != tt.latest {
+				t.Errorf("DockerTags() = %q, latest %v (%s), want %q, latest %v", got.Tags, got.Latest, got.Reason, tt.want, tt.latest)
+			}
+		})
+	}
+}
+
+func TestDockerTagsGitRev(t *testing.T) {
+	lib := NewMageLibrary(gitRepo(t, nil, "v1.0.0"))
+	got, err := lib.DockerTags(DockerTagPolicy{GitRev: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	git, _ := lib.GitDetails()
+	if len(got.Tags) != 1 || got.Tags[0] != git.Rev || git.Rev == "" {
+		t.Errorf("DockerTags() = %q, want [%s]", got.Tags, git.Rev)
+	}
+}
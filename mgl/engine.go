@@ -0,0 +1,399 @@
+package mgl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+)
+
+// Container engines supported
+const (
+	EngineDocker  = "docker"
+	EnginePodman  = "podman"
+	EngineBuildah = "buildah"
+)
+
+// ContainerEngine abstracts the container CLI used to build, run and push images
+type ContainerEngine interface {
+	// Name returns the name of the engine (and of its binary)
+	Name() string
+	// Build builds an image from a Dockerfile
+	Build(image string, opts BuildOptions) error
+	// BuildMultiArch builds and pushes a multi-architecture image
+	BuildMultiArch(spec MultiArchSpec) error
+	// Run runs a container from an image
+	Run(image string, opts RunOptions) error
+	// IsRunning reports whether a container with the given name is running
+	IsRunning(name string) bool
+	// Tag gives the dst name to the src image
+	Tag(src, dst string) error
+	// Push pushes an image to its registry
+	Push(image string) error
+	// Login logs in to a registry, the password being given on stdin
+	Login(registry, user, password string) error
+	// HasCredentials reports whether the engine configuration holds credentials for a registry
+	HasCredentials(registry string) bool
+	// ImageIDs returns the IDs of the images with the given name
+	ImageIDs(image string) ([]string, error)
+	// RemoveImages removes images by IDs
+	RemoveImages(ids ...string) error
+	// RemoveContainer removes a container by name, even if running
+	RemoveContainer(name string) error
+}
+
+// MultiArchSpec describes a multi-architecture image build
+type MultiArchSpec struct {
+	Images     []string // full image references to push
+	Platforms  []string // e.g. linux/amd64
+	Dockerfile string   // empty for <context>/Dockerfile
+	Context    string
+	BuildArgs  []string // KEY=VALUE
+	Insecure   bool     // registry is plain HTTP (e.g. local registry)
+}
+
+// BuildOptions holds the options to build an image
+type BuildOptions struct {
+	Dockerfile string   // empty for <context>/Dockerfile
+	Context    string   // empty for current directory
+	Target     string   // build stage, empty for the last one
+	Platform   string   // os/arch of the image, empty for the one of the engine
+	BuildArgs  []string // KEY=VALUE
+}
+
+// RunOptions holds the options to run a container
+type RunOptions struct {
+	Name     string            // container name
+	Detach   bool              // run in background
+	Remove   bool              // remove the container when it exits
+	User     string            // uid[:gid]
+	HostUser bool              // run as the current user, owning the files written in volumes
+	Env      map[string]string // environment variables
+	Volumes  []string          // host:container
+	Ports    []string          // host:container
+}
+
+// NewContainerEngine returns the container engine with the given name, running its
+// commands with env. The MAGEFILEP_CONTAINER_ENGINE variable takes precedence, and if
+// none is given, the first binary of docker, podman and buildah found on PATH is used.
+func NewContainerEngine(name string, env Env) (ContainerEngine, error) {
+	if val := env.Get("MAGEFILEP_CONTAINER_ENGINE"); val != "" {
+		name = val
+	}
+	if name == "" {
+		for _, n := range []string{EngineDocker, EnginePodman, EngineBuildah} {
+			if _, err := exec.LookPath(n); err == nil {
+				name = n
+				break
+			}
+		}
+		if name == "" {
+			return nil, errors.New("no container engine found on PATH (docker, podman or buildah)")
+		}
+	}
+
+	switch name {
+	case EngineDocker:
+		return &dockerEngine{cliEngine{EngineDocker, env}}, nil
+	case EnginePodman:
+		return &podmanEngine{cliEngine{EnginePodman, env}}, nil
+	case EngineBuildah:
+		return &buildahEngine{cliEngine{EngineBuildah, env}}, nil
+	}
+	return nil, fmt.Errorf("unknown container engine %q (docker, podman or buildah)", name)
+}
+
+// cliEngine holds the commands common to docker, podman and buildah CLIs
+type cliEngine struct {
+	cmd string
+	env Env
+}
+
+func (e *cliEngine) Name() string {
+	return e.cmd
+}
+
+func (e *cliEngine) run(args ...string) error {
+	return e.env.RunCmdStreamed(e.cmd, args...)
+}
+
+func (e *cliEngine) Build(image string, opts BuildOptions) error {
+	args := []string{"build", "-t", image}
+	if opts.Dockerfile != "" {
+		args = append(args, "-f", opts.Dockerfile)
+	}
+	if opts.Target != "" {
+		args = append(args, "--target", opts.Target)
+	}
+	if opts.Platform != "" {
+		args = append(args, "--platform", opts.Platform)
+	}
+	for _, arg := range opts.BuildArgs {
+		args = append(args, "--build-arg", arg)
+	}
+	context := opts.Context
+	if context == "" {
+		context = "."
+	}
+	return e.run(append(args, context)...)
+}
+
+func (e *cliEngine) Run(image string, opts RunOptions) error {
+	args := []string{"run"}
+	if opts.Name != "" {
+		args = append(args, "--name", opts.Name)
+	}
+	if opts.Detach {
+		args = append(args, "-d")
+	}
+	if opts.Remove {
+		args = append(args, "--rm")
+	}
+	args = append(args, e.userArgs(opts)...)
+	args = append(args, envArgs(opts.Env)...)
+	for _, vol := range opts.Volumes {
+		args = append(args, "-v", vol)
+	}
+	for _, port := range opts.Ports {
+		args = append(args, "-p", port)
+	}
+	return e.run(append(args, image)...)
+}
+
+// userArgs returns the arguments running the container as the user of the options.
+// Rootless podman maps the uid given by --user to a subordinate one of the host, so the
+// current user is kept with --userns=keep-id instead.
+func (e *cliEngine) userArgs(opts RunOptions) []string {
+	if opts.User != "" {
+		return []string{"--user", opts.User}
+	}
+	if !opts.HostUser {
+		return nil
+	}
+	uid, gid := os.Getuid(), os.Getgid()
+	switch {
+	case uid < 0 || gid < 0:
+		// no user ids on Windows
+		return nil
+	case e.cmd == EnginePodman && uid != 0:
+		return []string{"--userns=keep-id"}
+	}
+	return []string{"--user", fmt.Sprintf("%d:%d", uid, gid)}
+}
+
+func (e *cliEngine) IsRunning(name string) bool {
+	out, err := e.env.ExecOutput(e.cmd, "ps", "-q", "--filter", "name=^"+name+"$")
+	return err == nil && util.TrimString(out) != ""
+}
+
+func (e *cliEngine) Tag(src, dst string) error {
+	return e.run("tag", src, dst)
+}
+
+func (e *cliEngine) Push(image string) error {
+	return e.run("push", image)
+}
+
+func (e *cliEngine) Login(registry, user, password string) error {
+	args := []string{"login", "-u", user, "--password-stdin"}
+	if registry != "" {
+		args = append(args, registry)
+	}
+	return e.env.RunCmdWithInput(password, e.cmd, args...)
+}
+
+func (e *cliEngine) ImageIDs(image string) ([]string, error) {
+	out, err := e.env.ExecOutput(e.cmd, "images", "-q", image)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(out), nil
+}
+
+func (e *cliEngine) RemoveImages(ids ...string) error {
+	return e.run(append([]string{"rmi", "--force"}, ids...)...)
+}
+
+func (e *cliEngine) RemoveContainer(name string) error {
+	return e.env.RunCmd(e.cmd, "rm", "--force", name)
+}
+
+// dockerEngine builds multi-architecture images with buildx
+type dockerEngine struct {
+	cliEngine
+}
+
+const buildxBuilder = "mageproj"
+
+func (e *dockerEngine) HasCredentials(registry string) bool {
+	return DockerConfigHasCredentials(e.env, registry)
+}
+
+func (e *dockerEngine) BuildMultiArch(spec MultiArchSpec) error {
+	if _, err := e.env.ExecOutput(e.cmd, "buildx", "version"); err != nil {
+		return errors.New("docker buildx is not available: install the buildx plugin " +
+			"(see https://docs.docker.com/build/install-buildx/) or build a single-arch image")
+	}
+
+	// the default docker driver does not support multi-platform builds, and
+	// the host network is needed to reach a local registry
+	if _, err := e.env.ExecOutput(e.cmd, "buildx", "inspect", buildxBuilder); err != nil {
+		if err := e.run("buildx", "create", "--name", buildxBuilder,
+			"--driver", "docker-container", "--driver-opt", "network=host"); err != nil {
+			return err
+		}
+	}
+
+	args := []string{"buildx", "build", "--builder", buildxBuilder, "--push",
+		"--platform", strings.Join(spec.Platforms, ",")}
+	for _, image := range spec.Images {
+		args = append(args, "-t", image)
+	}
+	if spec.Dockerfile != "" {
+		args = append(args, "-f", spec.Dockerfile)
+	}
+	for _, arg := range spec.BuildArgs {
+		args = append(args, "--build-arg", arg)
+	}
+	return e.run(append(args, spec.Context)...)
+}
+
+// podmanEngine builds multi-architecture images as local manifest lists
+type podmanEngine struct {
+	cliEngine
+}
+
+func (e *podmanEngine) HasCredentials(registry string) bool {
+	return containersAuthHasCredentials(e.env, registry) || DockerConfigHasCredentials(e.env, registry)
+}
+
+func (e *podmanEngine) BuildMultiArch(spec MultiArchSpec) error {
+	return buildManifest(&e.cliEngine, spec)
+}
+
+// buildahEngine cannot run containers the way docker and podman do
+type buildahEngine struct {
+	cliEngine
+}
+
+func (e *buildahEngine) HasCredentials(registry string) bool {
+	return containersAuthHasCredentials(e.env, registry) || DockerConfigHasCredentials(e.env, registry)
+}
+
+func (e *buildahEngine) BuildMultiArch(spec MultiArchSpec) error {
+	return buildManifest(&e.cliEngine, spec)
+}
+
+func (e *buildahEngine) Run(image string, opts RunOptions) error {
+	if opts.Detach || len(opts.Ports) > 0 {
+		return errors.New("buildah cannot run detached containers nor publish ports, use docker or podman")
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = "mageproj-" + filepath.Base(strings.SplitN(image, ":", 2)[0])
+	}
+	if err := e.run("from", "--name", name, image); err != nil {
+		return err
+	}
+	defer e.env.RunCmd(e.cmd, "rm", name)
+
+	// the working container is always removed
+	args := []string{"run"}
+	args = append(args, e.userArgs(opts)...)
+	args = append(args, envArgs(opts.Env)...)
+	for _, vol := range opts.Volumes {
+		args = append(args, "-v", vol)
+	}
+	// buildah run needs the command, so read it from the image config
+	format := "{{range .OCIv1.Config.Entrypoint}}{{.}} {{end}}{{range .OCIv1.Config.Cmd}}{{.}} {{end}}"
+	cmd, err := e.env.ExecOutput(e.cmd, "inspect", "--type", "image", "--format", format, image)
+	if err != nil {
+		return err
+	}
+	args = append(args, name, "--")
+	return e.run(append(args, strings.Fields(cmd)...)...)
+}
+
+func (e *buildahEngine) IsRunning(name string) bool {
+	return false
+}
+
+func (e *buildahEngine) RemoveContainer(name string) error {
+	return e.env.RunCmd(e.cmd, "rm", name)
+}
+
+// envArgs returns the -e flags for the given environment, sorted for reproducibility
+func envArgs(env map[string]string) []string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var args []string
+	for _, k := range keys {
+		args = append(args, "-e", k+"="+env[k])
+	}
+	return args
+}
+
+// buildManifest builds a manifest list with podman or buildah, then pushes it with all its images
+func buildManifest(e *cliEngine, spec MultiArchSpec) error {
+	if len(spec.Images) == 0 {
+		return errors.New("no image to push")
+	}
+	manifest := spec.Images[0]
+
+	// the manifest must not exist, or images would be added to the previous ones
+	e.env.RunCmd(e.cmd, "manifest", "rm", manifest)
+
+	args := []string{"build", "--platform", strings.Join(spec.Platforms, ","), "--manifest", manifest}
+	if spec.Dockerfile != "" {
+		args = append(args, "-f", spec.Dockerfile)
+	}
+	for _, arg := range spec.BuildArgs {
+		args = append(args, "--build-arg", arg)
+	}
+	if err := e.run(append(args, spec.Context)...); err != nil {
+		return err
+	}
+
+	for _, image := range spec.Images {
+		args := []string{"manifest", "push", "--all"}
+		if spec.Insecure {
+			args = append(args, "--tls-verify=false")
+		}
+		if err := e.run(append(args, manifest, "docker://"+image)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// containersAuthHasCredentials reports whether the containers auth file
+// (used by podman and buildah) holds credentials for the registry
+func containersAuthHasCredentials(env Env, registry string) bool {
+	var files []string
+	if f := env.Get("REGISTRY_AUTH_FILE"); f != "" {
+		files = append(files, f)
+	}
+	if dir := env.Get("XDG_RUNTIME_DIR"); dir != "" {
+		files = append(files, filepath.Join(dir, "containers", "auth.json"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".config", "containers", "auth.json"))
+	}
+
+	for _, f := range files {
+		if configHasCredentials(f, registry) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package mgl
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestUserArgs(t *testing.T) {
+	uid, gid := os.Getuid(), os.Getgid()
+	if uid < 0 {
+		t.Skip("no user ids on this platform")
+	}
+	hostUser := []string{"--user", fmt.Sprintf("%d:%d", uid, gid)}
+	podmanHostUser := []string{"--userns=keep-id"}
+	if uid == 0 {
+		podmanHostUser = hostUser
+	}
+
+	tests := []struct {
+		name   string
+		engine string
+		opts   RunOptions
+		want   []string
+	}{
+		{"no user", EngineDocker, RunOptions{}, nil},
+		{"explicit user", EngineDocker, RunOptions{User: "1000:1000", HostUser: true}, []string{"--user", "1000:1000"}},
+		{"docker host user", EngineDocker, RunOptions{HostUser: true}, hostUser},
+		{"buildah host user", EngineBuildah, RunOptions{HostUser: true}, hostUser},
+		{"podman host user", EnginePodman, RunOptions{HostUser: true}, podmanHostUser},
+		{"podman explicit user", EnginePodman, RunOptions{User: "1000"}, []string{"--user", "1000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &cliEngine{cmd: tt.engine}
+			if got := e.userArgs(tt.opts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("userArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
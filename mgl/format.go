@@ -0,0 +1,138 @@
+package mgl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+)
+
+// Format checks code format via gofmt -s and goimports (if installed), printing
+// the unified diffs of the files not formatted and writing the format reports of
+// these files if enabled (see WithReportsDir)
+func (c *MageLibrary) Format() error {
+	files, err := c.goFiles()
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	env := c.toolsEnv()
+	unformatted := map[string]bool{}
+	var issues []LintIssue
+	for _, f := range c.formatters(env) {
+		// each formatter runs once on all the files
+		out, err := c.runFormatter(env, f.name, append(f.args, "-l"), files)
+		if err != nil {
+			return err
+		}
+		listed := strings.Fields(out)
+		if len(listed) == 0 {
+			continue
+		}
+
+		diff, err := c.runFormatter(env, f.name, append(f.args, "-d"), listed)
+		if err != nil {
+			return err
+		}
+		util.AlwaysLogf("The following files are not %s'ed:\n%s", f.name, diff)
+		for _, file := range listed {
+			unformatted[file] = true
+			issues = append(issues, LintIssue{Linter: f.name, File: file, Line: 1, Rule: "format",
+				Severity: "error", Message: fmt.Sprintf("file is not %s'ed (run FormatFix)", f.name)})
+		}
+	}
+
+	if err := c.writeIssueReports("format", issues); err != nil {
+		return err
+	}
+	if len(unformatted) > 0 {
+		return fmt.Errorf("%d improperly formatted go files (run FormatFix)", len(unformatted))
+	}
+	return nil
+}
+
+// FormatFix formats code in place via gofmt -s and goimports (if installed)
+func (c *MageLibrary) FormatFix() error {
+	files, err := c.goFiles()
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	env := c.toolsEnv()
+	for _, f := range c.formatters(env) {
+		out, err := c.runFormatter(env, f.name, append(f.args, "-l", "-w"), files)
+		if err != nil {
+			return err
+		}
+		for _, file := range strings.Fields(out) {
+			util.AlwaysLogf("Formatted %s with %s", file, f.name)
+		}
+	}
+	return nil
+}
+
+type formatter struct {
+	name string
+	args []string
+}
+
+// formatters returns gofmt then goimports if installed, which adds and
+// groups imports but does not simplify code as gofmt -s does
+func (c *MageLibrary) formatters(env Env) []formatter {
+	formatters := []formatter{{"gofmt", []string{"-s"}}}
+	if _, err := env.LookPath("goimports"); err != nil {
+		util.Log("goimports not installed (see InstallDeps) nor found on PATH, only gofmt is used")
+		return formatters
+	}
+
+	var args []string
+	if c.importsLocal != "" {
+		args = append(args, "-local", c.importsLocal)
+	}
+	return append(formatters, formatter{"goimports", args})
+}
+
+// goFiles returns all the .go files of the packages, relative to workdir
+func (c *MageLibrary) goFiles() ([]string, error) {
+	pkgs, err := c.PackageDetails()
+	if err != nil {
+		return nil, err
+	}
+	workdir, err := filepath.Abs(c.workdir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, pkg := range pkgs.Packages {
+		for _, f := range pkg.Files() {
+			if rel, err := filepath.Rel(workdir, f); err == nil {
+				f = rel
+			}
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// runFormatter runs a formatter in workdir on the files and returns its output.
+// As gofmt -d exits with 1 when it finds differences, only an exit status with
+// a message on the standard error is an error.
+func (c *MageLibrary) runFormatter(env Env, name string, args, files []string) (string, error) {
+	cmd := env.CommandIn(c.workdir, name, append(args, files...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || stderr.Len() > 0 {
+			return "", fmt.Errorf("error running %s: %v\n%s", name, err, stderr.String())
+		}
+	}
+	return string(out), nil
+}
@@ -0,0 +1,184 @@
+package mgl
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+)
+
+// FuzzTarget holds a fuzz test (func FuzzXxx(f *testing.F)) of a package
+type FuzzTarget struct {
+	Package string // import path
+	Dir     string // absolute directory of the package
+	Name    string
+}
+
+// CorpusDir returns the directory of the seed corpus of the target, where go test
+// writes the failing inputs
+func (t FuzzTarget) CorpusDir() string {
+	return filepath.Join(t.Dir, "testdata", "fuzz", t.Name)
+}
+
+// GeneratedDir returns the directory, under root, of the inputs generated by the
+// fuzzing engine for the target
+func (t FuzzTarget) GeneratedDir(root string) string {
+	return filepath.Join(root, filepath.FromSlash(t.Package), t.Name)
+}
+
+// FuzzResult holds the outcome of fuzzing a target
+type FuzzResult struct {
+	Target   FuzzTarget
+	Crashers []string // failing inputs, relative to workdir
+	Output   string
+	Err      error
+}
+
+// FuzzTargets returns the fuzz tests found in the test files of the packages
+func (c *MageLibrary) FuzzTargets() ([]FuzzTarget, error) {
+	pkgs, err := c.PackageDetails()
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []FuzzTarget
+	for _, pkg := range pkgs.Packages {
+		seen := map[string]bool{}
+		for _, f := range append(append([]string{}, pkg.TestGoFiles...), pkg.XTestGoFiles...) {
+			file, err := parser.ParseFile(token.NewFileSet(), filepath.Join(pkg.Dir, f), nil, 0)
+			if err != nil {
+				return nil, err
+			}
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || fn.Recv != nil || !strings.HasPrefix(fn.Name.Name, "Fuzz") || !isFuzzFunc(fn) {
+					continue
+				}
+				if !seen[fn.Name.Name] {
+					seen[fn.Name.Name] = true
+					targets = append(targets, FuzzTarget{Package: pkg.ImportPath, Dir: pkg.Dir, Name: fn.Name.Name})
+				}
+			}
+		}
+	}
+	return targets, nil
+}
+
+// isFuzzFunc reports whether the function takes a single *testing.F parameter
+func isFuzzFunc(fn *ast.FuncDecl) bool {
+	params := fn.Type.Params.List
+	if len(params) != 1 || len(params[0].Names) > 1 {
+		return false
+	}
+	star, ok := params[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == "F"
+}
+
+var failingInput = regexp.MustCompile(`Failing input written to (\S+)`)
+
+// Fuzz runs go test -fuzz on the target for the duration with the flags, the failing
+// inputs being written into its seed corpus (see CorpusDir). With a corpus dir (e.g.
+// GeneratedDir or CorpusDir), the inputs generated by the fuzzing engine in the Go
+// build cache are restored from it before, and saved into it after, so that next runs
+// start from them even on CI with no Go build cache, when the corpus dir is kept.
+func (c *MageLibrary) Fuzz(t FuzzTarget, fuzztime time.Duration, flags []string, corpusDir string) FuzzResult {
+	result := FuzzResult{Target: t}
+	cacheDir := ""
+	if corpusDir != "" {
+		cache, err := c.env.ExecOutputIn(c.workdir, c.env.GoCmd(), "env", "GOCACHE")
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		cacheDir = t.GeneratedDir(filepath.Join(util.TrimString(cache), "fuzz"))
+		if _, err := copyNewFiles(corpusDir, cacheDir); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	args := append([]string{"test", "-run=^$", "-fuzz=^" + regexp.QuoteMeta(t.Name) + "$",
+		"-fuzztime=" + fuzztime.String()}, flags...)
+	cmd := c.env.CommandIn(t.Dir, c.env.GoCmd(), append(args, ".")...)
+	out, err := cmd.CombinedOutput()
+	result.Output = string(out)
+	result.Err = err
+
+	workdir, _ := filepath.Abs(c.workdir)
+	for _, crasher := range failingInputs(t.Dir, result.Output) {
+		if rel, err := filepath.Rel(workdir, crasher); err == nil {
+			crasher = rel
+		}
+		result.Crashers = append(result.Crashers, crasher)
+	}
+
+	if cacheDir != "" {
+		kept, err := copyNewFiles(cacheDir, corpusDir)
+		if err != nil && result.Err == nil {
+			result.Err = err
+		}
+		if kept > 0 {
+			util.Logf("%d new inputs of %s kept in %s", kept, t.Name, corpusDir)
+		}
+	}
+	return result
+}
+
+// failingInputs returns the failing inputs reported in the output of go test -fuzz
+// run in dir, as absolute file names
+func failingInputs(dir, output string) []string {
+	var files []string
+	for _, m := range failingInput.FindAllStringSubmatch(output, -1) {
+		files = append(files, absFile(dir, m[1]))
+	}
+	return files
+}
+
+// copyNewFiles copies the files of src missing from dst, if src exists, and returns
+// the number of files copied
+func copyNewFiles(src, dst string) (int, error) {
+	files, err := ioutil.ReadDir(src)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return 0, err
+	}
+	copied := 0
+	for _, f := range files {
+		target := filepath.Join(dst, f.Name())
+		if f.IsDir() || fileExists(target) {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(src, f.Name()))
+		if err != nil {
+			return copied, err
+		}
+		if err := ioutil.WriteFile(target, data, 0644); err != nil {
+			return copied, err
+		}
+		copied++
+	}
+	return copied, nil
+}
+
+// Reproducer returns the go test command re-running the target on a failing input
+func (r FuzzResult) Reproducer(crasher string) string {
+	return fmt.Sprintf("go test -run=%s/%s %s", r.Target.Name, filepath.Base(crasher), r.Target.Package)
+}
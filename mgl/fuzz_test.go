@@ -0,0 +1,183 @@
+package mgl
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsFuzzFunc(t *testing.T) {
+	src := `package p
+
+import (
+	"testing"
+	fuzz "testing"
+)
+
+func FuzzOK(f *testing.F)          {}
+func FuzzAlias(f *fuzz.F)          {}
+func FuzzUnnamed(*testing.F)       {}
+func FuzzTest(t *testing.T)        {}
+func FuzzValue(f testing.F)        {}
+func FuzzTwo(f, g *testing.F)      {}
+func FuzzMore(f *testing.F, n int) {}
+func FuzzNone()                    {}
+func FuzzLocal(f *F)               {}
+`
+	file, err := parser.ParseFile(token.NewFileSet(), "p_test.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"FuzzOK": true, "FuzzAlias": true, "FuzzUnnamed": true}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		if got := isFuzzFunc(fn); got != want[fn.Name.Name] {
+			t.Errorf("isFuzzFunc(%s) = %v, want %v", fn.Name.Name, got, want[fn.Name.Name])
+		}
+	}
+}
+
+// fuzzModule writes a module with the fuzz test FuzzDecode and returns its directory
+func fuzzModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":   "module example.com/fuzz\n\ngo 1.18\n",
+		"codec.go": "package codec\n\nfunc Decode(s string) bool { return len(s) < 3 }\n",
+		"codec_test.go": `package codec
+
+import "testing"
+
+func FuzzDecode(f *testing.F) {
+	f.Add("ab")
+	f.Fuzz(func(t *testing.T, s string) {
+		if !Decode(s) {
+			t.Fatalf("Decode(%q) failed", s)
+		}
+	})
+}
+`,
+	})
+	writeFiles(t, dir, files)
+	return dir
+}
+
+func TestFuzzTargets(t *testing.T) {
+	dir := fuzzModule(t, map[string]string{
+		"suite_test.go": `package codec
+
+import "testing"
+
+type suite struct{}
+
+func (suite) FuzzMethod(f *testing.F) {}
+`,
+		"codec_x_test.go": `package codec_test
+
+import "testing"
+
+func FuzzDecode(f *testing.F) {}
+
+func FuzzExternal(f *testing.F) {}
+`,
+		"sub/sub_test.go": "package sub\n\nimport \"testing\"\n\nfunc FuzzSub(f *testing.F) {}\n",
+	})
+	targets, err := NewMageLibrary(dir, WithEnv(Env{"GOFLAGS": ""})).FuzzTargets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, target := range targets {
+		got = append(got, target.Package+" "+target.Name)
+	}
+	want := []string{"example.com/fuzz FuzzDecode", "example.com/fuzz FuzzExternal", "example.com/fuzz/sub FuzzSub"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FuzzTargets() = %q, want %q", got, want)
+	}
+	if len(targets) == 3 && targets[2].CorpusDir() != filepath.Join(dir, "sub", "testdata", "fuzz", "FuzzSub") {
+		t.Errorf("CorpusDir() = %s, want sub/testdata/fuzz/FuzzSub", targets[2].CorpusDir())
+	}
+}
+
+func TestFailingInputs(t *testing.T) {
+	output := `--- FAIL: FuzzDecode (0.05s)
+    --- FAIL: FuzzDecode (0.00s)
+        codec_test.go:8: Decode("abc") failed
+
+    Failing input written to testdata/fuzz/FuzzDecode/81476e3145e0ed8c
+    To re-run:
+    go test -run=FuzzDecode/81476e3145e0ed8c
+    Failing input written to /src/codec/testdata/fuzz/FuzzDecode/0123456789abcdef
+FAIL
+`
+	got := failingInputs("/src/codec", output)
+	want := []string{filepath.Join("/src/codec", "testdata", "fuzz", "FuzzDecode", "81476e3145e0ed8c"),
+		"/src/codec/testdata/fuzz/FuzzDecode/0123456789abcdef"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("failingInputs() = %q, want %q", got, want)
+	}
+	if got := failingInputs("/src/codec", "ok  \texample.com/fuzz\t1.2s\n"); len(got) != 0 {
+		t.Errorf("failingInputs() of a passing run = %q, want none", got)
+	}
+}
+
+func TestCopyNewFiles(t *testing.T) {
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "corpus")
+	writeFiles(t, src, map[string]string{"a": "new a", "b": "new b", "dir/c": "c"})
+	writeFiles(t, dst, map[string]string{"a": "old a"})
+
+	n, err := copyNewFiles(src, dst)
+	if err != nil || n != 1 {
+		t.Fatalf("copyNewFiles() = %d, %v, want 1 file copied", n, err)
+	}
+	for name, want := range map[string]string{"a": "old a", "b": "new b"} {
+		if data, _ := ioutil.ReadFile(filepath.Join(dst, name)); string(data) != want {
+			t.Errorf("%s = %q, want %q", name, data, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst, "dir")); !os.IsNotExist(err) {
+		t.Error("directory of src copied")
+	}
+
+	if n, err := copyNewFiles(filepath.Join(src, "missing"), dst); n != 0 || err != nil {
+		t.Errorf("copyNewFiles() of a missing dir = %d, %v, want nothing", n, err)
+	}
+}
+
+func TestFuzz(t *testing.T) {
+	if testing.Short() {
+		t.Skip("fuzzing in short mode")
+	}
+	dir := fuzzModule(t, nil)
+	corpusDir := filepath.Join(dir, "build", "fuzz")
+	lib := NewMageLibrary(dir, WithEnv(Env{"GOFLAGS": ""}))
+	target := FuzzTarget{Package: "example.com/fuzz", Dir: dir, Name: "FuzzDecode"}
+
+	result := lib.Fuzz(target, 10*time.Second, []string{"-parallel=1"}, target.GeneratedDir(corpusDir))
+	if result.Err == nil || len(result.Crashers) != 1 {
+		t.Fatalf("Fuzz() = %v, crashers %q, want one failing input\n%s", result.Err, result.Crashers, result.Output)
+	}
+	crasher := result.Crashers[0]
+	if filepath.Dir(crasher) != filepath.Join("testdata", "fuzz", "FuzzDecode") {
+		t.Errorf("failing input %s not in the seed corpus", crasher)
+	}
+	if files, _ := ioutil.ReadDir(target.CorpusDir()); len(files) != 1 {
+		t.Errorf("seed corpus holds %d files, want only the failing input", len(files))
+	}
+	if want := "go test -run=FuzzDecode/" + filepath.Base(crasher) + " example.com/fuzz"; result.Reproducer(crasher) != want {
+		t.Errorf("Reproducer() = %s, want %s", result.Reproducer(crasher), want)
+	}
+	if !strings.HasPrefix(target.GeneratedDir(corpusDir), corpusDir) {
+		t.Errorf("GeneratedDir() = %s, want it under %s", target.GeneratedDir(corpusDir), corpusDir)
+	}
+}
@@ -0,0 +1,345 @@
+package mgl
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+)
+
+// TestEvent holds an event of go test -json (see go doc test2json)
+type TestEvent struct {
+	Time    time.Time
+	Action  string  // start, run, pause, cont, pass, bench, fail, output or skip
+	Package string  `json:",omitempty"`
+	Test    string  `json:",omitempty"`
+	Elapsed float64 `json:",omitempty"` // seconds
+	Output  string  `json:",omitempty"`
+}
+
+// GoTestJSON runs go test -json with the arguments in dir, printing the output of
+// the tests in verbose mode and the failed tests, and returns the test events
+func GoTestJSON(env Env, dir string, args ...string) ([]TestEvent, error) {
+	cmd := env.CommandIn(dir, env.GoCmd(), append([]string{"test", "-json"}, args...)...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	var events []TestEvent
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var ev TestEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil || ev.Action == "" {
+			// not an event, e.g. a build error
+			util.AlwaysLog(scanner.Text())
+			continue
+		}
+		events = append(events, ev)
+		if ev.Action == "output" && env.Verbose() {
+			fmt.Print(ev.Output)
+		}
+		if ev.Action == "fail" && ev.Test != "" {
+			util.AlwaysLogf("--- FAIL: %s %s", ev.Package, ev.Test)
+		}
+	}
+	scanErr := scanner.Err()
+
+	if err := cmd.Wait(); err != nil {
+		return events, err
+	}
+	return events, scanErr
+}
+
+// WriteTestEvents writes the events as go test -json does, one per line
+func WriteTestEvents(filename string, events []TestEvent) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// WriteJUnit writes the test events as a JUnit XML report, with a test suite per
+// package and a test case per test (subtests included). A package failing without
+// a failed test (e.g. not building) gets a failed test case named after it.
+func WriteJUnit(filename string, events []TestEvent) error {
+	type failure struct {
+		Message string `xml:"message,attr"`
+		Text    string `xml:",chardata"`
+	}
+	type skipped struct {
+		Message string `xml:"message,attr"`
+	}
+	type testCase struct {
+		Classname string   `xml:"classname,attr"`
+		Name      string   `xml:"name,attr"`
+		Time      string   `xml:"time,attr"`
+		Failure   *failure `xml:"failure,omitempty"`
+		Skipped   *skipped `xml:"skipped,omitempty"`
+		SystemOut string   `xml:"system-out,omitempty"`
+		action    string
+		output    strings.Builder
+	}
+	type testSuite struct {
+		Name      string      `xml:"name,attr"`
+		Tests     int         `xml:"tests,attr"`
+		Failures  int         `xml:"failures,attr"`
+		Skipped   int         `xml:"skipped,attr"`
+		Time      string      `xml:"time,attr"`
+		Timestamp string      `xml:"timestamp,attr,omitempty"`
+		Cases     []*testCase `xml:"testcase"`
+		SystemOut string      `xml:"system-out,omitempty"`
+		action    string
+		output    strings.Builder
+		byName    map[string]*testCase
+	}
+	type testSuites struct {
+		XMLName  xml.Name     `xml:"testsuites"`
+		Tests    int          `xml:"tests,attr"`
+		Failures int          `xml:"failures,attr"`
+		Skipped  int          `xml:"skipped,attr"`
+		Suites   []*testSuite `xml:"testsuite"`
+	}
+
+	seconds := func(s float64) string { return fmt.Sprintf("%.3f", s) }
+
+	doc := testSuites{}
+	suites := map[string]*testSuite{}
+	for _, ev := range events {
+		suite, present := suites[ev.Package]
+		if !present {
+			suite = &testSuite{Name: ev.Package, byName: map[string]*testCase{}}
+			if !ev.Time.IsZero() {
+				suite.Timestamp = ev.Time.Format(time.RFC3339)
+			}
+			suites[ev.Package] = suite
+			doc.Suites = append(doc.Suites, suite)
+		}
+
+		if ev.Test == "" {
+			switch ev.Action {
+			case "output":
+				suite.output.WriteString(ev.Output)
+			case "pass", "fail", "skip":
+				suite.action = ev.Action
+				suite.Time = seconds(ev.Elapsed)
+			}
+			continue
+		}
+
+		tc, present := suite.byName[ev.Test]
+		if !present {
+			tc = &testCase{Classname: ev.Package, Name: ev.Test, Time: seconds(0)}
+			suite.byName[ev.Test] = tc
+			suite.Cases = append(suite.Cases, tc)
+		}
+		switch ev.Action {
+		case "output":
+			tc.output.WriteString(ev.Output)
+		case "pass", "fail", "skip":
+			tc.action = ev.Action
+			tc.Time = seconds(ev.Elapsed)
+		}
+	}
+
+	for _, suite := range doc.Suites {
+		failed := false
+		for _, tc := range suite.Cases {
+			switch tc.action {
+			case "fail":
+				tc.Failure = &failure{Message: "Failed", Text: tc.output.String()}
+				suite.Failures++
+				failed = true
+			case "skip":
+				tc.Skipped = &skipped{Message: strings.TrimSpace(tc.output.String())}
+				suite.Skipped++
+			case "pass":
+				tc.SystemOut = tc.output.String()
+			default:
+				// no outcome, e.g. a test interrupted by a panic or a timeout
+				tc.Failure = &failure{Message: "No test result", Text: tc.output.String()}
+				suite.Failures++
+				failed = true
+			}
+		}
+		if suite.action == "fail" && !failed {
+			suite.Cases = append(suite.Cases, &testCase{Classname: suite.Name, Name: suite.Name, Time: suite.Time,
+				Failure: &failure{Message: "Failed", Text: suite.output.String()}})
+			suite.Failures++
+		} else {
+			suite.SystemOut = suite.output.String()
+		}
+		if suite.Time == "" {
+			suite.Time = seconds(0)
+		}
+		suite.Tests = len(suite.Cases)
+		doc.Tests += suite.Tests
+		doc.Failures += suite.Failures
+		doc.Skipped += suite.Skipped
+	}
+
+	return writeXML(filename, doc)
+}
+
+// FlakyTest holds a test which failed, then passed on retry
+type FlakyTest struct {
+	Package  string `json:"package"`
+	Test     string `json:"test"`
+	Failures int    `json:"failures"` // runs failed before passing
+}
+
+// TestFailures returns the top-level tests which failed, by package, and the
+// packages which failed without a failed test (e.g. not building)
+func TestFailures(events []TestEvent) (map[string][]string, []string) {
+	failed := map[string][]string{}
+	testFailed := map[string]bool{}
+	pkgFailed := map[string]bool{}
+	var pkgs []string
+	for _, ev := range events {
+		if ev.Action != "fail" {
+			continue
+		}
+		if ev.Test == "" {
+			if !pkgFailed[ev.Package] {
+				pkgFailed[ev.Package] = true
+				pkgs = append(pkgs, ev.Package)
+			}
+		} else if !strings.Contains(ev.Test, "/") && !testFailed[ev.Package+" "+ev.Test] {
+			// a failed subtest fails its parent, which is re-run as a whole
+			testFailed[ev.Package+" "+ev.Test] = true
+			failed[ev.Package] = append(failed[ev.Package], ev.Test)
+		}
+	}
+
+	var broken []string
+	for _, pkg := range pkgs {
+		if len(failed[pkg]) == 0 {
+			broken = append(broken, pkg)
+		}
+	}
+	return failed, broken
+}
+
+// RetryFailedTests re-runs with the go test flags, up to retries times, the top-level
+// tests failed according to the events and the error of a first run. It returns the
+// events of all the runs and the flaky tests (the ones passing on retry), failing if
+// some tests failed or got no result at every run, some packages failed without a
+// failed test, a retry failed with no test failing, or the first run failed with no
+// test to retry (e.g. an invalid flag).
+func RetryFailedTests(env Env, dir string, retries int, flags []string, events []TestEvent, runErr error) ([]TestEvent, []FlakyTest, error) {
+	failed, broken := TestFailures(events)
+	if len(broken) > 0 {
+		return events, nil, fmt.Errorf("packages failed without failed test: %s", strings.Join(broken, ", "))
+	}
+	if len(failed) == 0 {
+		return events, nil, runErr
+	}
+
+	var flaky []FlakyTest
+	for attempt := 1; attempt <= retries && len(failed) > 0; attempt++ {
+		pkgs := make([]string, 0, len(failed))
+		for pkg := range failed {
+			pkgs = append(pkgs, pkg)
+		}
+		sort.Strings(pkgs)
+
+		for _, pkg := range pkgs {
+			tests := failed[pkg]
+			util.AlwaysLogf("Retrying %d failed tests of %s (retry %d of %d)", len(tests), pkg, attempt, retries)
+			patterns := make([]string, len(tests))
+			for i, t := range tests {
+				patterns[i] = regexp.QuoteMeta(t)
+			}
+			args := append(append([]string{}, flags...), "-count=1", "-run=^("+strings.Join(patterns, "|")+")$", pkg)
+
+			retried, err := GoTestJSON(env, dir, args...)
+			events = append(events, retried...)
+			if len(retried) == 0 && err != nil {
+				return events, flaky, fmt.Errorf("error retrying tests of %s: %v", pkg, err)
+			}
+			if _, broken := TestFailures(retried); len(broken) > 0 {
+				return events, flaky, fmt.Errorf("packages failed without failed test: %s", strings.Join(broken, ", "))
+			}
+
+			passed, stillFailed := RetryResults(pkg, tests, retried)
+			for _, t := range passed {
+				flaky = append(flaky, FlakyTest{Package: pkg, Test: t, Failures: attempt})
+			}
+			if len(stillFailed) == 0 && err != nil {
+				// the tests passed, but not go test
+				return events, flaky, fmt.Errorf("error retrying tests of %s: %v", pkg, err)
+			}
+			if len(stillFailed) > 0 {
+				failed[pkg] = stillFailed
+			} else {
+				delete(failed, pkg)
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		var names []string
+		for pkg, tests := range failed {
+			for _, t := range tests {
+				names = append(names, pkg+"."+t)
+			}
+		}
+		sort.Strings(names)
+		return events, flaky, fmt.Errorf("%d tests failed at every run: %s", len(names), strings.Join(names, ", "))
+	}
+	return events, flaky, nil
+}
+
+// RetryResults splits the tests of pkg re-run according to the events of the retry
+// into the ones which passed and the ones still failing, a test without a pass
+// event (failed, interrupted or not run) being still failing
+func RetryResults(pkg string, tests []string, events []TestEvent) ([]string, []string) {
+	pass := map[string]bool{}
+	for _, ev := range events {
+		if ev.Package != pkg || ev.Test == "" {
+			continue
+		}
+		switch ev.Action {
+		case "pass", "fail", "skip":
+			pass[ev.Test] = ev.Action == "pass"
+		}
+	}
+
+	var passed, failed []string
+	for _, t := range tests {
+		if pass[t] {
+			passed = append(passed, t)
+		} else {
+			failed = append(failed, t)
+		}
+	}
+	return passed, failed
+}
+
+// WriteFlakyTests writes the flaky tests as a JSON report
+func WriteFlakyTests(filename string, flaky []FlakyTest) error {
+	if flaky == nil {
+		flaky = []FlakyTest{}
+	}
+	return writeJSON(filename, flaky)
+}
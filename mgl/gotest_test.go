@@ -0,0 +1,137 @@
+package mgl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFiles writes the files of content, by path relative to dir
+func writeFiles(t *testing.T, dir string, content map[string]string) {
+	t.Helper()
+	for name, data := range content {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTestFailures(t *testing.T) {
+	events := []TestEvent{
+		{Action: "run", Package: "m/a", Test: "TestOK"},
+		{Action: "pass", Package: "m/a", Test: "TestOK"},
+		{Action: "fail", Package: "m/a", Test: "TestSub/case_1"},
+		{Action: "fail", Package: "m/a", Test: "TestSub/case_2"},
+		{Action: "fail", Package: "m/a", Test: "TestSub"},
+		{Action: "fail", Package: "m/a", Test: "TestFlaky"},
+		{Action: "fail", Package: "m/a"},
+		{Action: "fail", Package: "m/b"}, // not building
+		{Action: "pass", Package: "m/c"},
+	}
+	failed, broken := TestFailures(events)
+	if want := map[string][]string{"m/a": {"TestSub", "TestFlaky"}}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("TestFailures() failed = %v, want %v", failed, want)
+	}
+	if want := []string{"m/b"}; !reflect.DeepEqual(broken, want) {
+		t.Errorf("TestFailures() broken = %v, want %v", broken, want)
+	}
+}
+
+func TestRetryResults(t *testing.T) {
+	tests := []string{"TestPass", "TestFail", "TestPanic", "TestNotRun", "TestSkip", "TestFailThenPass"}
+	events := []TestEvent{
+		{Action: "run", Package: "m/a", Test: "TestPass"},
+		{Action: "pass", Package: "m/a", Test: "TestPass"},
+		{Action: "pass", Package: "m/other", Test: "TestFail"},
+		{Action: "run", Package: "m/a", Test: "TestFail"},
+		{Action: "fail", Package: "m/a", Test: "TestFail"},
+		{Action: "run", Package: "m/a", Test: "TestPanic"},
+		{Action: "output", Package: "m/a", Test: "TestPanic", Output: "panic: boom\n"},
+		{Action: "run", Package: "m/a", Test: "TestSkip"},
+		{Action: "skip", Package: "m/a", Test: "TestSkip"},
+		{Action: "pass", Package: "m/a", Test: "TestFailThenPass/case"},
+		{Action: "fail", Package: "m/a", Test: "TestFailThenPass"},
+		{Action: "pass", Package: "m/a", Test: "TestFailThenPass"},
+		{Action: "fail", Package: "m/a"},
+	}
+	passed, failed := RetryResults("m/a", tests, events)
+	if want := []string{"TestPass", "TestFailThenPass"}; !reflect.DeepEqual(passed, want) {
+		t.Errorf("RetryResults() passed = %v, want %v", passed, want)
+	}
+	if want := []string{"TestFail", "TestPanic", "TestNotRun", "TestSkip"}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("RetryResults() failed = %v, want %v", failed, want)
+	}
+
+	// no event at all, e.g. go test not starting
+	if passed, failed := RetryResults("m/a", tests, nil); len(passed) != 0 || !reflect.DeepEqual(failed, tests) {
+		t.Errorf("RetryResults() without events = %v, %v, want all failing", passed, failed)
+	}
+}
+
+func TestRetryFailedTests(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod": "module example.com/flaky\n\ngo 1.17\n",
+		"flaky_test.go": `package flaky
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFlaky(t *testing.T) {
+	if _, err := os.Stat("ran"); err != nil {
+		os.WriteFile("ran", nil, 0644)
+		t.Fatal("first run")
+	}
+}
+
+func TestBroken(t *testing.T) {
+	t.Fatal("every run")
+}
+
+func TestOK(t *testing.T) {}
+`,
+	})
+
+	env := Env{"GOFLAGS": ""}
+	events, err := GoTestJSON(env, dir, "./...")
+	if err == nil {
+		t.Fatal("GoTestJSON() succeeded, want failed tests")
+	}
+	_, flaky, err := RetryFailedTests(env, dir, 2, nil, events, err)
+	if want := []FlakyTest{{Package: "example.com/flaky", Test: "TestFlaky", Failures: 1}}; !reflect.DeepEqual(flaky, want) {
+		t.Errorf("RetryFailedTests() flaky = %+v, want %+v", flaky, want)
+	}
+	if err == nil || err.Error() != "1 tests failed at every run: example.com/flaky.TestBroken" {
+		t.Errorf("RetryFailedTests() error = %v, want TestBroken failing at every run", err)
+	}
+}
+
+func TestRetryFailedTestsNothingToRetry(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":     "module example.com/ok\n\ngo 1.17\n",
+		"ok_test.go": "package ok\n\nimport \"testing\"\n\nfunc TestOK(t *testing.T) {}\n",
+	})
+
+	env := Env{"GOFLAGS": ""}
+	events, runErr := GoTestJSON(env, dir, "-count=x", "./...")
+	if runErr == nil {
+		t.Fatal("GoTestJSON() with an invalid flag succeeded")
+	}
+	if _, _, err := RetryFailedTests(env, dir, 1, []string{"-count=x"}, events, runErr); err != runErr {
+		t.Errorf("RetryFailedTests() = %v, want the error of the first run %v", err, runErr)
+	}
+
+	events, runErr = GoTestJSON(env, dir, "./...")
+	if _, flaky, err := RetryFailedTests(env, dir, 1, nil, events, runErr); err != nil || len(flaky) != 0 {
+		t.Errorf("RetryFailedTests() of a passing run = %v, %v, want no error", flaky, err)
+	}
+}
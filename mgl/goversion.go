@@ -0,0 +1,189 @@
+package mgl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MinGoVersion is the lowest Go version supported by MageLibrary, which runs
+// go install pkg@version and builds files with //go:build constraints
+const MinGoVersion = "1.17"
+
+// GoVersion holds a Go version (e.g. 1.21.3 or 1.22rc1)
+type GoVersion struct {
+	Major int
+	Minor int
+	Patch int
+	Pre   string // pre-release (e.g. rc1), before the release
+}
+
+var goVersionRegexp = regexp.MustCompile(`^(?:go)?(\d+)(?:\.(\d+))?(?:\.(\d+))?((?:rc|beta)\d+)?$`)
+
+// ParseGoVersion parses a Go version, with or without go prefix (e.g. go1.21.3 or 1.21)
+func ParseGoVersion(s string) (GoVersion, error) {
+	m := goVersionRegexp.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return GoVersion{}, fmt.Errorf("invalid Go version %q", s)
+	}
+	var v GoVersion
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	v.Patch, _ = strconv.Atoi(m[3])
+	v.Pre = m[4]
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 whether the version is lower, equal or greater than o
+func (v GoVersion) Compare(o GoVersion) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	switch {
+	case v.Pre == o.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case o.Pre == "":
+		return -1
+	}
+	// beta before rc, then by number (rc9 before rc10)
+	vKind, vNum := v.preRelease()
+	oKind, oNum := o.preRelease()
+	if c := strings.Compare(vKind, oKind); c != 0 {
+		return c
+	}
+	switch {
+	case vNum < oNum:
+		return -1
+	case vNum > oNum:
+		return 1
+	}
+	return 0
+}
+
+// preRelease returns the kind (beta or rc) and the number of the pre-release
+func (v GoVersion) preRelease() (string, int) {
+	i := strings.IndexAny(v.Pre, "0123456789")
+	if i < 0 {
+		return v.Pre, 0
+	}
+	n, _ := strconv.Atoi(v.Pre[i:])
+	return v.Pre[:i], n
+}
+
+func (v GoVersion) String() string {
+	s := fmt.Sprintf("%d.%d", v.Major, v.Minor)
+	if v.Patch > 0 {
+		s += fmt.Sprintf(".%d", v.Patch)
+	}
+	return s + v.Pre
+}
+
+// GoToolchain holds a Go toolchain installed
+type GoToolchain struct {
+	GoCmd   string // path of the go command
+	Version GoVersion
+}
+
+var goVersionOutput = regexp.MustCompile(`go(\d+(?:\.\d+){0,2}(?:(?:rc|beta)\d+)?)`)
+
+// ToolchainVersion returns the version of a go command, as is, without switching to
+// the toolchain required by go.mod (GOTOOLCHAIN=local)
+func (c *MageLibrary) ToolchainVersion(gocmd string) (GoVersion, error) {
+	out, err := c.env.With(Env{"GOTOOLCHAIN": "local"}).ExecOutputIn(c.workdir, gocmd, "version")
+	if err != nil {
+		return GoVersion{}, fmt.Errorf("unable to run %s version: %v", gocmd, err)
+	}
+	m := goVersionOutput.FindStringSubmatch(out)
+	if m == nil {
+		return GoVersion{}, fmt.Errorf("unknown Go version in %q", strings.TrimSpace(out))
+	}
+	return ParseGoVersion(m[1])
+}
+
+// GoModVersions returns the versions required by the go and toolchain (empty if
+// none) directives of go.mod in workdir
+func (c *MageLibrary) GoModVersions() (string, string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(c.workdir, "go.mod"))
+	if err != nil {
+		return "", "", err
+	}
+	goVersion, toolchain := "", ""
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "go":
+			goVersion = fields[1]
+		case "toolchain":
+			toolchain = strings.TrimPrefix(fields[1], "go")
+		}
+	}
+	return goVersion, toolchain, nil
+}
+
+// FindGoToolchains returns the Go toolchains installed: the one named by GOTOOLCHAIN
+// (e.g. go1.22.3) first, then the goX.Y.Z commands found on PATH (golang.org/dl) and
+// the toolchains of ~/sdk, the latest first
+func (c *MageLibrary) FindGoToolchains() []GoToolchain {
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+
+	var candidates []string
+	if name := strings.SplitN(c.env.Get("GOTOOLCHAIN"), "+", 2)[0]; strings.HasPrefix(name, "go1") {
+		if path, err := c.env.LookPath(name); err == nil {
+			candidates = append(candidates, path)
+		}
+		if home, err := os.UserHomeDir(); err == nil {
+			candidates = append(candidates, filepath.Join(home, "sdk", name, "bin", "go"+exe))
+		}
+	}
+	var others []string
+	for _, dir := range filepath.SplitList(c.env.Get("PATH")) {
+		matches, _ := filepath.Glob(filepath.Join(dir, "go1*"+exe))
+		others = append(others, matches...)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		matches, _ := filepath.Glob(filepath.Join(home, "sdk", "go1*", "bin", "go"+exe))
+		others = append(others, matches...)
+	}
+
+	var toolchains []GoToolchain
+	seen := map[string]bool{}
+	add := func(paths []string) {
+		var found []GoToolchain
+		for _, path := range paths {
+			if seen[path] || !fileExists(path) {
+				continue
+			}
+			seen[path] = true
+			if v, err := c.ToolchainVersion(path); err == nil {
+				found = append(found, GoToolchain{GoCmd: path, Version: v})
+			}
+		}
+		sort.SliceStable(found, func(i, j int) bool { return found[i].Version.Compare(found[j].Version) > 0 })
+		toolchains = append(toolchains, found...)
+	}
+	add(candidates)
+	add(others)
+	return toolchains
+}
@@ -0,0 +1,95 @@
+package mgl
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseGoVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    GoVersion
+		str     string
+		wantErr bool
+	}{
+		{in: "1.21", want: GoVersion{Major: 1, Minor: 21}, str: "1.21"},
+		{in: "go1.21.3", want: GoVersion{Major: 1, Minor: 21, Patch: 3}, str: "1.21.3"},
+		{in: " 1.21.0\n", want: GoVersion{Major: 1, Minor: 21}, str: "1.21"},
+		{in: "go1.22rc1", want: GoVersion{Major: 1, Minor: 22, Pre: "rc1"}, str: "1.22rc1"},
+		{in: "1.18beta2", want: GoVersion{Major: 1, Minor: 18, Pre: "beta2"}, str: "1.18beta2"},
+		{in: "2", want: GoVersion{Major: 2}, str: "2.0"},
+		{in: "1.21.x", wantErr: true},
+		{in: "v1.21", wantErr: true},
+		{in: "1.22alpha1", wantErr: true},
+		{in: "1.22rc", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseGoVersion(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseGoVersion(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want || got.String() != tt.str {
+			t.Errorf("ParseGoVersion(%q) = %+v (%s), %v, want %+v (%s)", tt.in, got, got, err, tt.want, tt.str)
+		}
+	}
+}
+
+func TestGoVersionCompare(t *testing.T) {
+	// in increasing order
+	versions := []string{"1.17", "1.20.14", "1.21beta1", "1.21rc2", "1.21rc9", "1.21rc10", "1.21.0", "1.21.1",
+		"1.21.10", "1.22beta1", "1.22beta10", "1.22rc1", "1.22", "2.0"}
+	for i, a := range versions {
+		va, err := ParseGoVersion(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j, b := range versions {
+			vb, _ := ParseGoVersion(b)
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := va.Compare(vb); got != want {
+				t.Errorf("%s.Compare(%s) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+
+	if v, w := (GoVersion{Major: 1, Minor: 21}), (GoVersion{Major: 1, Minor: 21, Patch: 0}); v.Compare(w) != 0 {
+		t.Errorf("1.21.Compare(1.21.0) = %d, want 0", v.Compare(w))
+	}
+}
+
+func TestGoModVersions(t *testing.T) {
+	tests := []struct {
+		name      string
+		gomod     string
+		goVersion string
+		toolchain string
+	}{
+		{"go and toolchain", "module example.com/m\n\ngo 1.21.0\n\ntoolchain go1.22.3\n", "1.21.0", "1.22.3"},
+		{"go only", "module example.com/m\n\ngo 1.18\n\nrequire example.com/dep v1.0.0\n", "1.18", ""},
+		{"comments", "module example.com/m // main\n\ngo 1.21 // minimum\ntoolchain go1.21.5 // tested\n", "1.21", "1.21.5"},
+		{"none", "module example.com/m\n", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"go.mod": tt.gomod})
+			goVersion, toolchain, err := NewMageLibrary(dir).GoModVersions()
+			if err != nil || goVersion != tt.goVersion || toolchain != tt.toolchain {
+				t.Errorf("GoModVersions() = %q, %q, %v, want %q, %q", goVersion, toolchain, err, tt.goVersion, tt.toolchain)
+			}
+		})
+	}
+
+	if _, _, err := NewMageLibrary(t.TempDir()).GoModVersions(); !os.IsNotExist(err) {
+		t.Errorf("GoModVersions() without go.mod = %v, want a not exist error", err)
+	}
+}
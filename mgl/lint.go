@@ -0,0 +1,336 @@
+package mgl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+)
+
+// Linters supported
+const (
+	LinterGolangCI    = "golangci-lint"
+	LinterStaticcheck = "staticcheck"
+	LinterRevive      = "revive"
+)
+
+// lint severity levels, from the lowest to the highest
+var lintSeverities = []string{"info", "warning", "error"}
+
+// LintIssue holds an issue found by a linter
+type LintIssue struct {
+	Linter   string
+	File     string
+	Line     int
+	Column   int
+	Rule     string // check or rule (e.g. SA4006 for staticcheck)
+	Severity string // info, warning or error
+	Message  string
+}
+
+// String formats the issue as file:line:column: message (linter rule) [severity]
+func (i LintIssue) String() string {
+	rule := i.Linter
+	if i.Rule != "" {
+		rule += " " + i.Rule
+	}
+	return fmt.Sprintf("%s:%d:%d: %s (%s) [%s]", i.File, i.Line, i.Column, i.Message, rule, i.Severity)
+}
+
+// Linter abstracts the linter CLI run on the packages of a workdir
+type Linter interface {
+	// Name returns the name of the linter (and of its binary)
+	Name() string
+	// ConfigFile returns the configuration file of the linter found in workdir, empty if none
+	ConfigFile(workdir string) string
+	// Run runs the linter on the packages of workdir and returns the issues found
+	Run(env Env, workdir string) ([]LintIssue, error)
+}
+
+// NewLinter returns the linter with the given name
+func NewLinter(name string) (Linter, error) {
+	switch name {
+	case LinterGolangCI:
+		return &golangciLinter{}, nil
+	case LinterStaticcheck:
+		return &staticcheckLinter{}, nil
+	case LinterRevive:
+		return &reviveLinter{}, nil
+	}
+	return nil, fmt.Errorf("unknown linter %q (%s, %s or %s)", name, LinterGolangCI, LinterStaticcheck, LinterRevive)
+}
+
+// Lint runs the linters (see WithLinters, none by default, as installed by Tools) on
+// the packages of workdir and prints the issues found. It fails if some have a severity equal or above
+// the lint severity (see WithLintSeverity). The lint reports of all the issues are
+// written if enabled (see WithReportsDir).
+func (c *MageLibrary) Lint() error {
+	names := c.linters
+	if len(names) == 0 {
+		util.Log("No linter to run (see WithLinters)")
+		return nil
+	}
+	level := severityLevel(c.lintSeverity)
+	if level < 0 {
+		return fmt.Errorf("unknown lint severity %q (one of %s)", c.lintSeverity, strings.Join(lintSeverities, ", "))
+	}
+
+	workdir, err := filepath.Abs(c.workdir)
+	if err != nil {
+		return err
+	}
+
+	env := c.toolsEnv()
+	failing := 0
+	var all []LintIssue
+	for _, name := range names {
+		linter, err := NewLinter(name)
+		if err != nil {
+			return err
+		}
+		if cfg := linter.ConfigFile(workdir); cfg != "" {
+			util.Logf("Using %s configuration file %s", name, cfg)
+		}
+
+		issues, err := linter.Run(env, workdir)
+		if err != nil {
+			return err
+		}
+		for _, issue := range issues {
+			if rel, err := filepath.Rel(workdir, issue.File); err == nil {
+				issue.File = rel
+			}
+			util.AlwaysLog(issue.String())
+			all = append(all, issue)
+			if severityLevel(issue.Severity) >= level {
+				failing++
+			}
+		}
+	}
+
+	if err := c.writeIssueReports("lint", all); err != nil {
+		return err
+	}
+	if failing > 0 {
+		return fmt.Errorf("%d lint issues of severity %s or above", failing, lintSeverities[level])
+	}
+	return nil
+}
+
+// severityLevel returns the index of the severity in lintSeverities, -1 if unknown
+func severityLevel(severity string) int {
+	for i, s := range lintSeverities {
+		if s == strings.ToLower(severity) {
+			return i
+		}
+	}
+	return -1
+}
+
+// findConfigFile returns the first of the files found in workdir, empty if none
+func findConfigFile(workdir string, files ...string) string {
+	for _, f := range files {
+		path := filepath.Join(workdir, f)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// absFile returns the path of a file given relative to workdir or absolute
+func absFile(workdir, file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(workdir, file)
+}
+
+// runLinter runs a linter in workdir and returns its standard output. Linters exit
+// with a non-zero status when they find issues, so this is an error only if nothing
+// is written on the standard output.
+func runLinter(env Env, workdir, name string, args ...string) ([]byte, error) {
+	cmd := env.CommandIn(workdir, name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("unable to run %s (see InstallDeps): %v", name, err)
+		}
+		if len(bytes.TrimSpace(out)) == 0 {
+			return nil, fmt.Errorf("error running %s: %v\n%s", name, err, stderr.String())
+		}
+	}
+	if env.Verbose() && stderr.Len() > 0 {
+		util.AlwaysLog(stderr.String())
+	}
+	return out, nil
+}
+
+// golangciLinter runs golangci-lint, v1 or v2
+type golangciLinter struct{}
+
+func (l *golangciLinter) Name() string {
+	return LinterGolangCI
+}
+
+func (l *golangciLinter) ConfigFile(workdir string) string {
+	return findConfigFile(workdir, ".golangci.yml", ".golangci.yaml", ".golangci.toml", ".golangci.json")
+}
+
+var golangciVersion = regexp.MustCompile(`version v?(\d+)\.`)
+
+func (l *golangciLinter) Run(env Env, workdir string) ([]LintIssue, error) {
+	args := []string{"run"}
+	// the JSON output flags changed with v2
+	version, _ := env.ExecOutputIn(workdir, LinterGolangCI, "version")
+	if m := golangciVersion.FindStringSubmatch(version); m != nil && m[1] != "1" {
+		args = append(args, "--output.json.path=stdout", "--show-stats=false")
+	} else {
+		args = append(args, "--out-format=json")
+	}
+	if cfg := l.ConfigFile(workdir); cfg != "" {
+		args = append(args, "--config", cfg)
+	}
+
+	out, err := runLinter(env, workdir, LinterGolangCI, append(args, "./...")...)
+	if err != nil {
+		return nil, err
+	}
+
+	var report struct {
+		Issues []struct {
+			FromLinter string
+			Text       string
+			Severity   string
+			Pos        struct {
+				Filename string
+				Line     int
+				Column   int
+			}
+		}
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, nil
+	}
+	if err := json.Unmarshal(out, &report); err != nil {
+		return nil, fmt.Errorf("invalid %s output: %v", LinterGolangCI, err)
+	}
+
+	var issues []LintIssue
+	for _, i := range report.Issues {
+		severity := i.Severity
+		if severityLevel(severity) < 0 {
+			severity = "error" // issues fail golangci-lint unless severities are configured
+		}
+		issues = append(issues, LintIssue{Linter: LinterGolangCI, File: absFile(workdir, i.Pos.Filename),
+			Line: i.Pos.Line, Column: i.Pos.Column, Rule: i.FromLinter, Severity: severity, Message: i.Text})
+	}
+	return issues, nil
+}
+
+// staticcheckLinter runs staticcheck, which finds its staticcheck.conf by itself
+type staticcheckLinter struct{}
+
+func (l *staticcheckLinter) Name() string {
+	return LinterStaticcheck
+}
+
+func (l *staticcheckLinter) ConfigFile(workdir string) string {
+	return findConfigFile(workdir, "staticcheck.conf")
+}
+
+func (l *staticcheckLinter) Run(env Env, workdir string) ([]LintIssue, error) {
+	out, err := runLinter(env, workdir, LinterStaticcheck, "-f", "json", "./...")
+	if err != nil {
+		return nil, err
+	}
+
+	// one JSON object per line
+	var issues []LintIssue
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		var p struct {
+			Code     string
+			Severity string
+			Location struct {
+				File   string
+				Line   int
+				Column int
+			}
+			Message string
+		}
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			return nil, fmt.Errorf("invalid %s output: %v", LinterStaticcheck, err)
+		}
+		if p.Severity == "ignored" {
+			continue
+		}
+		issues = append(issues, LintIssue{Linter: LinterStaticcheck, File: p.Location.File, Line: p.Location.Line,
+			Column: p.Location.Column, Rule: p.Code, Severity: p.Severity, Message: p.Message})
+	}
+	return issues, scanner.Err()
+}
+
+// reviveLinter runs revive
+type reviveLinter struct{}
+
+func (l *reviveLinter) Name() string {
+	return LinterRevive
+}
+
+func (l *reviveLinter) ConfigFile(workdir string) string {
+	return findConfigFile(workdir, "revive.toml", ".revive.toml")
+}
+
+func (l *reviveLinter) Run(env Env, workdir string) ([]LintIssue, error) {
+	args := []string{"-formatter", "json"}
+	if cfg := l.ConfigFile(workdir); cfg != "" {
+		args = append(args, "-config", cfg)
+	}
+
+	out, err := runLinter(env, workdir, LinterRevive, append(args, "./...")...)
+	if err != nil {
+		return nil, err
+	}
+
+	var failures []struct {
+		Severity string
+		Failure  string
+		RuleName string
+		Position struct {
+			Start struct {
+				Filename string
+				Line     int
+				Column   int
+			}
+		}
+	}
+	if len(bytes.TrimSpace(out)) > 0 {
+		if err := json.Unmarshal(out, &failures); err != nil {
+			return nil, fmt.Errorf("invalid %s output: %v", LinterRevive, err)
+		}
+	}
+
+	var issues []LintIssue
+	for _, f := range failures {
+		issues = append(issues, LintIssue{Linter: LinterRevive, File: absFile(workdir, f.Position.Start.Filename),
+			Line: f.Position.Start.Line, Column: f.Position.Start.Column, Rule: f.RuleName, Severity: f.Severity,
+			Message: f.Failure})
+	}
+	return issues, nil
+}
@@ -0,0 +1,38 @@
+package mgl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLintersInstalled(t *testing.T) {
+	tests := []struct {
+		name    string
+		linters []string
+		want    []string
+	}{
+		{"no linter", nil, []string{"goimports"}},
+		{"linters", []string{LinterStaticcheck, LinterRevive}, []string{"goimports", LinterStaticcheck, LinterRevive}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lib := NewMageLibrary(t.TempDir(), WithLinters(tt.linters...))
+			tools, err := lib.Tools()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, tool := range tools {
+				got = append(got, tool.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tools() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// without linter, Lint runs none rather than one not installed
+	if err := NewMageLibrary(t.TempDir()).Lint(); err != nil {
+		t.Errorf("Lint() without linter = %v, want nil", err)
+	}
+}
@@ -1,12 +1,11 @@
 package mgl
 
 import (
-	"errors"
+	"encoding/json"
 	"fmt"
-	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -16,13 +15,27 @@ import (
 
 // MageLibrary provides Mage independent functions to build its own targets
 type MageLibrary struct {
-	workdir string
-	pkgs    *PackageInfos
-	git     *GitInfos
-	art     *ArtifactInfos
-	dck     *DockerInfos
+	workdir      string
+	env          Env
+	mergeCommits bool
+	clStats      bool
+	importsLocal string
+	linters      []string
+	lintSeverity string
+	tools        []Tool
+	toolsDir     string
+	reportsDir   string
+	pkgs         *PackageInfos
+	git          *GitInfos
+	art          *ArtifactInfos
+	dck          *DockerInfos
 }
 
+// Env holds environment variables set on top of the process environment, given
+// to the commands run by MageLibrary and used instead of the MAGEFILEP_* variables
+// of the process (see WithEnv)
+type Env = util.Env
+
 // MageLibraryOption defines an operation on MageLibrary (to set a param)
 type MageLibraryOption func(*MageLibrary)
 
@@ -32,14 +45,53 @@ type GitInfos struct {
 	TagAtRev       string
 	LatestTag      string
 	RevAtLatestTag string
+	Branch         string
 	init           sync.Once
 }
 
 // PackageInfos holds information regarding the go project
 type PackageInfos struct {
-	prefixLen int
-	Names     []string
-	init      sync.Once
+	Names    []string // packages relative to workdir (e.g. ./mgl or . for the root one)
+	Packages []Package
+	err      error
+	init     sync.Once
+}
+
+// Package holds information regarding a package of the go project, as given by go list
+type Package struct {
+	ImportPath   string
+	Name         string
+	Dir          string   // absolute directory
+	RelDir       string   // directory relative to workdir (e.g. ./mgl or .)
+	GoFiles      []string // .go source files (excluding CgoFiles, TestGoFiles, XTestGoFiles)
+	CgoFiles     []string // .go source files that import "C"
+	TestGoFiles  []string // _test.go files in package
+	XTestGoFiles []string // _test.go files outside package
+	Imports      []string // import paths used by this package
+	Module       string   // module path, empty outside module mode
+	Main         bool     // main package, building a binary
+}
+
+// Files returns the paths of all the .go files of the package, test files included
+func (p Package) Files() []string {
+	var files []string
+	for _, list := range [][]string{p.GoFiles, p.CgoFiles, p.TestGoFiles, p.XTestGoFiles} {
+		for _, f := range list {
+			files = append(files, filepath.Join(p.Dir, f))
+		}
+	}
+	return files
+}
+
+// MainPackages returns the main packages of the go project
+func (i *PackageInfos) MainPackages() []Package {
+	var mains []Package
+	for _, pkg := range i.Packages {
+		if pkg.Main {
+			mains = append(mains, pkg)
+		}
+	}
+	return mains
 }
 
 // ArtifactInfos holds information regarding artifacts registry
@@ -59,19 +111,11 @@ type DockerInfos struct {
 	init     sync.Once
 }
 
-// historyTokens converts git log history to tokens
-type historyTokens struct {
-	refNames      string
-	committerDate string
-	commitHash    string
-	committerName string
-	subject       string
-}
-
 // NewMageLibrary constructs a new MageLibrary instance
 func NewMageLibrary(workdir string, options ...MageLibraryOption) *MageLibrary {
 	commons := &MageLibrary{}
 	commons.workdir = workdir
+	commons.lintSeverity = "warning"
 	commons.pkgs = &PackageInfos{}
 	commons.git = &GitInfos{}
 	commons.art = &ArtifactInfos{}
@@ -82,11 +126,60 @@ func NewMageLibrary(workdir string, options ...MageLibraryOption) *MageLibrary {
 	return commons
 }
 
-// Workdir returns the workdir used
+// WithEnv adds the variables to env, the environment given to commands
+func WithEnv(val Env) MageLibraryOption {
+	return func(c *MageLibrary) {
+		c.env = c.env.With(val)
+	}
+}
+
+// WithImportsLocal sets importsLocal to value, the import path prefix goimports
+// puts after 3rd-party packages (e.g. mycompany.fr/myapp)
+func WithImportsLocal(val string) MageLibraryOption {
+	return func(c *MageLibrary) {
+		c.importsLocal = val
+	}
+}
+
+// WithLinters sets linters to value (golangci-lint, staticcheck or revive), run by Lint
+func WithLinters(val ...string) MageLibraryOption {
+	return func(c *MageLibrary) {
+		c.linters = val
+	}
+}
+
+// WithLintSeverity sets lintSeverity to value (info, warning or error), the lowest
+// severity of the lint issues failing Lint
+func WithLintSeverity(val string) MageLibraryOption {
+	return func(c *MageLibrary) {
+		c.lintSeverity = val
+	}
+}
+
+// WithMergeCommits sets mergeCommits to value, to keep merge commits in ChangeLog
+func WithMergeCommits(val bool) MageLibraryOption {
+	return func(c *MageLibrary) {
+		c.mergeCommits = val
+	}
+}
+
+// WithChangeLogStats sets clStats to value, to add statistics per release in ChangeLog
+func WithChangeLogStats(val bool) MageLibraryOption {
+	return func(c *MageLibrary) {
+		c.clStats = val
+	}
+}
+
+// Workdir returns the workdir used, where go commands run
 func (c *MageLibrary) Workdir() string {
 	return c.workdir
 }
 
+// Env returns the environment given to commands
+func (c *MageLibrary) Env() Env {
+	return c.env
+}
+
 // Version extracts version from git tag
 func (c *MageLibrary) Version() string {
 	timestamp := time.Now().UnixNano() / int64(time.Millisecond)
@@ -103,23 +196,81 @@ func (c *MageLibrary) Version() string {
 	return version
 }
 
-// PackageDetails aggregates the package information regarding the go project
+// PackageDetails aggregates the package information regarding the go project, with go list
 func (c *MageLibrary) PackageDetails() (*PackageInfos, error) {
-	var err error
 	c.pkgs.init.Do(func() {
-		var s string
-		s, err = util.ExecOutput(util.GoCmd(), "list", "./...")
-		if err != nil {
-			return
-		}
-		names := strings.Split(s, "\n")
-		for i := range names {
-			names[i] = "." + names[i][c.pkgs.prefixLen:]
+		c.pkgs.Packages, c.pkgs.err = c.listPackages()
+		for _, pkg := range c.pkgs.Packages {
+			c.pkgs.Names = append(c.pkgs.Names, pkg.RelDir)
 		}
-		c.pkgs.Names = names
 	})
 
-	return c.pkgs, err
+	return c.pkgs, c.pkgs.err
+}
+
+// listPackages runs go list -json on the packages of workdir
+func (c *MageLibrary) listPackages() ([]Package, error) {
+	out, err := c.env.ExecOutputIn(c.workdir, c.env.GoCmd(), "list", "-json", "./...")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list packages: %v", err)
+	}
+	workdir, err := filepath.Abs(c.workdir)
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []Package
+	// go list -json writes a stream of JSON objects, not an array
+	dec := json.NewDecoder(strings.NewReader(out))
+	for dec.More() {
+		var p struct {
+			Package
+			Module *struct {
+				Path string
+			}
+		}
+		if err := dec.Decode(&p); err != nil {
+			return nil, fmt.Errorf("invalid go list output: %v", err)
+		}
+
+		pkg := p.Package
+		if p.Module != nil {
+			pkg.Module = p.Module.Path
+		}
+		pkg.Main = pkg.Name == "main"
+		pkg.RelDir = "."
+		if rel, err := filepath.Rel(workdir, pkg.Dir); err == nil && rel != "." {
+			pkg.RelDir = "./" + filepath.ToSlash(rel)
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs, nil
+}
+
+// ImportsPackage reports whether the package pkg depends on the package dep, when
+// built with the flags (e.g. -tags=...)
+func (c *MageLibrary) ImportsPackage(pkg, dep string, flags ...string) bool {
+	args := append(append([]string{"list", "-deps", "-f", "{{.ImportPath}}"}, flags...), pkg)
+	out, err := c.env.ExecOutputIn(c.workdir, c.env.GoCmd(), args...)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == dep {
+			return true
+		}
+	}
+	return false
+}
+
+// ShortRev returns the short git revision of a ref (e.g. a tag or a branch)
+func (c *MageLibrary) ShortRev(ref string) (string, error) {
+	gitDir := filepath.Join(c.Workdir(), ".git")
+	out, err := c.env.ExecOutput(c.env.GitCmd(), "--git-dir", gitDir, "rev-parse", "--short", ref)
+	if err != nil {
+		return "", fmt.Errorf("unknown git ref %s: %v", ref, err)
+	}
+	return util.TrimString(out), nil
 }
 
 // GitDetails aggregates the information regarding git
@@ -128,13 +279,13 @@ func (c *MageLibrary) GitDetails() (*GitInfos, error) {
 	c.git.init.Do(func() {
 		gitDir := filepath.Join(c.Workdir(), ".git")
 
-		c.git.Rev, _ = util.ExecOutput(util.GitCmd(), "--git-dir", gitDir, "rev-parse", "--short", "HEAD")
+		c.git.Rev, _ = c.env.ExecOutput(c.env.GitCmd(), "--git-dir", gitDir, "rev-parse", "--short", "HEAD")
 		c.git.Rev = util.TrimString(c.git.Rev)
 
-		c.git.TagAtRev, _ = util.ExecOutput(util.GitCmd(), "--git-dir", gitDir, "tag", fmt.Sprintf("--points-at=%s", c.git.Rev))
+		c.git.TagAtRev, _ = c.env.ExecOutput(c.env.GitCmd(), "--git-dir", gitDir, "tag", fmt.Sprintf("--points-at=%s", c.git.Rev))
 		c.git.TagAtRev = util.TrimString(c.git.TagAtRev)
 
-		c.git.LatestTag, _ = util.ExecOutput(util.GitCmd(), "--git-dir", gitDir, "for-each-ref", "--format=\"%(tag)\"", "--sort=-taggerdate", "refs/tags")
+		c.git.LatestTag, _ = c.env.ExecOutput(c.env.GitCmd(), "--git-dir", gitDir, "for-each-ref", "--format=\"%(tag)\"", "--sort=-taggerdate", "refs/tags")
 		if c.git.LatestTag != "" {
 			allTags := strings.Split(c.git.LatestTag, "\n")
 			if len(allTags) > 0 {
@@ -143,8 +294,18 @@ func (c *MageLibrary) GitDetails() (*GitInfos, error) {
 		}
 		c.git.LatestTag = util.TrimString(c.git.LatestTag)
 
-		c.git.RevAtLatestTag, _ = util.ExecOutput(util.GitCmd(), "--git-dir", gitDir, "rev-list", "--abbrev-commit", "-n", "1", c.git.LatestTag)
+		c.git.RevAtLatestTag, _ = c.env.ExecOutput(c.env.GitCmd(), "--git-dir", gitDir, "rev-list", "--abbrev-commit", "-n", "1", c.git.LatestTag)
 		c.git.RevAtLatestTag = util.TrimString(c.git.RevAtLatestTag)
+
+		// CI usually checks out a detached HEAD, so the branch may be given by env
+		c.git.Branch = c.env.Get("MAGEFILEP_GIT_BRANCH")
+		if c.git.Branch == "" {
+			c.git.Branch, _ = c.env.ExecOutput(c.env.GitCmd(), "--git-dir", gitDir, "rev-parse", "--abbrev-ref", "HEAD")
+			c.git.Branch = util.TrimString(c.git.Branch)
+			if c.git.Branch == "HEAD" {
+				c.git.Branch = ""
+			}
+		}
 	})
 	return c.git, err
 }
@@ -156,10 +317,10 @@ func (c *MageLibrary) ArtifactDetails(url, user string) *ArtifactInfos {
 		c.art.Usr = user
 		c.art.Pwd = "to.be.set"
 	})
-	if usr := os.Getenv("MAGEFILEP_ARTIFACT_USR"); usr != "" {
+	if usr := c.env.Get("MAGEFILEP_ARTIFACT_USR"); usr != "" {
 		c.art.Usr = usr
 	}
-	if pwd := os.Getenv("MAGEFILEP_ARTIFACT_PWD"); pwd != "" {
+	if pwd := c.env.Get("MAGEFILEP_ARTIFACT_PWD"); pwd != "" {
 		c.art.Pwd = pwd
 	}
 	return c.art
@@ -171,164 +332,95 @@ func (c *MageLibrary) DockerDetails(registry, image, user string) *DockerInfos {
 		c.dck.Registry = registry
 		c.dck.Image = image
 		c.dck.Usr = user
-		c.dck.Pwd = "to.be.set"
 	})
-	if usr := os.Getenv("MAGEFILEP_DOCKER_USR"); usr != "" {
+	if usr := c.env.Get("MAGEFILEP_DOCKER_USR"); usr != "" {
 		c.dck.Usr = usr
 	}
-	if pwd := os.Getenv("MAGEFILEP_DOCKER_PWD"); pwd != "" {
+	if pwd := c.env.Get("MAGEFILEP_DOCKER_PWD"); pwd != "" {
 		c.dck.Pwd = pwd
 	}
 	return c.dck
 }
 
-// Format formats code via gofmt
-func (c *MageLibrary) Format() error {
-	pkgs, err := c.PackageDetails()
-	if err != nil {
-		return err
-	}
-
-	failed := false
-	first := true
-	for _, pkg := range pkgs.Names {
-		files, err := filepath.Glob(filepath.Join(pkg, "*.go"))
-		if err != nil {
-			return nil
-		}
-		for _, f := range files {
-			// gofmt doesn't exit with non-zero when it finds unformatted code
-			// so we have to explicitly look for output, and if we find any, we
-			// should fail this target.
-			s, err := util.ExecOutput("gofmt", "-l", f)
-			if err != nil {
-				fmt.Printf("ERROR: running gofmt on %q: %v\n", f, err)
-				failed = true
-			}
-			if s != "" {
-				if first {
-					util.AlwaysLog("The following files are not gofmt'ed:")
-					first = false
-				}
-				failed = true
-				util.AlwaysLog(s)
-			}
+// Vet runs go vet linter, writing the vet reports of its issues if enabled (see WithReportsDir)
+func (c *MageLibrary) Vet() error {
+	if c.reportsDir == "" {
+		if err := c.env.RunCmdIn(c.workdir, c.env.GoCmd(), "vet", "./..."); err != nil {
+			return fmt.Errorf("error running go vet: %v", err)
 		}
+		return nil
 	}
-	if failed {
-		return errors.New("improperly formatted go files")
-	}
-	return nil
-}
 
-// Lint runs golint linter
-func (c *MageLibrary) Lint() error {
-	pkgs, err := c.PackageDetails()
+	issues, err := c.vetIssues()
 	if err != nil {
 		return err
 	}
-
-	failed := false
-	for _, pkg := range pkgs.Names {
-		// We don't actually want to fail this target if we find golint errors,
-		// so we don't pass -set_exit_status, but we still print out any failures.
-		if err := exec.Command("golint", pkg).Run(); err != nil {
-			fmt.Printf("ERROR: running go lint on %q: %v\n", pkg, err)
-			failed = true
-		}
+	for _, issue := range issues {
+		util.AlwaysLog(issue.String())
 	}
-	if failed {
-		return errors.New("errors running golint")
+	if err := c.writeIssueReports("vet", issues); err != nil {
+		return err
 	}
-	return nil
-}
-
-// Vet runs go vet linter
-func (c *MageLibrary) Vet() error {
-	if err := util.RunCmd(util.GoCmd(), "vet", "./..."); err != nil {
-		return fmt.Errorf("error running go vet: %v", err)
+	if len(issues) > 0 {
+		return fmt.Errorf("%d go vet issues", len(issues))
 	}
 	return nil
 }
 
-// InstallDeps installs the additional dependencies: goimports & golint
-func (c *MageLibrary) InstallDeps() error {
-	err := util.RunCmd(util.GoCmd(), "install", "golang.org/x/lint/golint@latest")
-	if err == nil {
-		return err
-	}
-	err = util.RunCmd(util.GoCmd(), "install", "golang.org/x/tools/cmd/goimports@latest")
-	return err
-}
-
-// ChangeLog generates a ChangeLog based on git history
-func (c *MageLibrary) ChangeLog(version, filename string, artifactURL, gitURL string) error {
-	newfile, err := os.Create(filename)
+// vetIssues runs go vet -json and returns the issues found, with files relative to workdir
+func (c *MageLibrary) vetIssues() ([]LintIssue, error) {
+	workdir, err := filepath.Abs(c.workdir)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer newfile.Close()
-
-	t := time.Now()
-	ts := t.Format("2006-01-02 15:04:05 -0700")
-	fl := fmt.Sprintf("\n## Release [%s](%s/%s) (%s)\n\n", version, artifactURL, version, ts)
-	if _, err = newfile.WriteString(fl); err != nil {
-		return err
-	}
-
-	gitDir := filepath.Join(c.Workdir(), ".git")
-	out, err := util.ExecOutput(util.GitCmd(), "--git-dir", gitDir, "log", "--pretty=\"tformat:%d|%ci|%h|%cn|%s\"")
-	if err != nil {
-		return nil
+	// go vet -json writes on the standard error a "# package" line followed by a
+	// JSON object per package: {"package": {"analyzer": [{"posn": ..., "message": ...}]}}
+	out, runErr := c.env.CommandIn(c.workdir, c.env.GoCmd(), "vet", "-json", "./...").CombinedOutput()
+	var objects []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			objects = append(objects, line)
+		}
 	}
 
-	tag := regexp.MustCompile(`^.*tag: (v[0-9]+\.[0-9]+\.[0-9]+).*$`)
-
-	lines := strings.Split(out, "\n")
-	for _, line := range lines {
-		tokens := convertToTokens(line)
-		if tokens == nil {
-			continue
+	var issues []LintIssue
+	dec := json.NewDecoder(strings.NewReader(strings.Join(objects, "\n")))
+	for dec.More() {
+		var pkgs map[string]map[string][]struct {
+			Posn    string
+			Message string
 		}
-		var outs string
-		if tag.MatchString(tokens.refNames) {
-			match := tag.FindStringSubmatch(tokens.refNames)
-			outs = fmt.Sprintf("\n## Release [%s](%s/%s) (%s)\n\n", match[1], artifactURL, match[1], tokens.committerDate)
-
-			if _, err = newfile.WriteString(outs); err != nil {
-				return err
-			}
+		if err := dec.Decode(&pkgs); err != nil {
+			return nil, fmt.Errorf("error running go vet: %v\n%s", runErr, out)
 		}
-
-		if keep := os.Getenv("MAGEFILEP_MERGE_COMMIT"); keep != "yes" {
-			if strings.Contains(tokens.subject, "Merge branch") {
-				if strings.Contains(tokens.subject, "into") {
-					continue
+		for _, analyzers := range pkgs {
+			for analyzer, diags := range analyzers {
+				for _, d := range diags {
+					issue := LintIssue{Linter: "vet", Rule: analyzer, Severity: "error", Message: d.Message}
+					issue.File, issue.Line, issue.Column = splitPosition(d.Posn)
+					if rel, err := filepath.Rel(workdir, issue.File); err == nil {
+						issue.File = rel
+					}
+					issues = append(issues, issue)
 				}
 			}
 		}
-
-		outs = fmt.Sprintf("* [%s](%s/commit/%s) - %s (%s)\n", tokens.commitHash, gitURL, tokens.commitHash, tokens.subject, tokens.committerName)
-
-		if _, err = newfile.WriteString(outs); err != nil {
-			return err
-		}
+	}
+	if runErr != nil && len(issues) == 0 {
+		return nil, fmt.Errorf("error running go vet: %v\n%s", runErr, out)
 	}
 
-	util.AlwaysLogf("File %s generated", newfile.Name())
-	return nil
+	sort.Slice(issues, func(i, j int) bool { return issues[i].String() < issues[j].String() })
+	return issues, nil
 }
 
-func convertToTokens(line string) *historyTokens {
-	tokens := strings.Split(line, "|")
-	if len(tokens) < 5 {
-		return nil
+// splitPosition splits a file:line:column position
+func splitPosition(posn string) (string, int, int) {
+	parts := strings.Split(posn, ":")
+	if len(parts) < 3 {
+		return posn, 0, 0
 	}
-	history := historyTokens{}
-	history.refNames = util.TrimString(tokens[0])
-	history.committerDate = util.TrimString(tokens[1])
-	history.commitHash = util.TrimString(tokens[2])
-	history.committerName = util.TrimString(tokens[3])
-	history.subject = util.TrimString(tokens[4])
-	return &history
+	line, _ := strconv.Atoi(parts[len(parts)-2])
+	column, _ := strconv.Atoi(parts[len(parts)-1])
+	return strings.Join(parts[:len(parts)-2], ":"), line, column
 }
@@ -0,0 +1,206 @@
+package mgl
+
+import (
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// WithReportsDir sets reportsDir to value, the directory where Format, Vet and Lint
+// write the reports of their issues (none if empty)
+func WithReportsDir(val string) MageLibraryOption {
+	return func(c *MageLibrary) {
+		c.reportsDir = val
+	}
+}
+
+// ReportsDir returns the directory where the reports are written, empty if none
+func (c *MageLibrary) ReportsDir() string {
+	return c.reportsDir
+}
+
+// writeIssueReports writes the reports of the issues found by a target, if enabled
+func (c *MageLibrary) writeIssueReports(name string, issues []LintIssue) error {
+	if c.reportsDir == "" {
+		return nil
+	}
+	return WriteIssueReports(c.reportsDir, name, issues)
+}
+
+// WriteIssueReports writes the issues as SARIF (<name>.sarif), Checkstyle
+// (<name>.checkstyle.xml) and GitLab Code Quality (<name>.codequality.json) reports
+// into dir, each overwritten
+func WriteIssueReports(dir, name string, issues []LintIssue) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := WriteSARIF(filepath.Join(dir, name+".sarif"), issues); err != nil {
+		return err
+	}
+	if err := WriteCheckstyle(filepath.Join(dir, name+".checkstyle.xml"), issues); err != nil {
+		return err
+	}
+	return WriteCodeQuality(filepath.Join(dir, name+".codequality.json"), issues)
+}
+
+// WriteSARIF writes the issues as a SARIF 2.1.0 log, with a run per linter
+func WriteSARIF(filename string, issues []LintIssue) error {
+	type region struct {
+		StartLine   int `json:"startLine,omitempty"`
+		StartColumn int `json:"startColumn,omitempty"`
+	}
+	type location struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+			Region region `json:"region"`
+		} `json:"physicalLocation"`
+	}
+	type result struct {
+		RuleID  string `json:"ruleId,omitempty"`
+		Level   string `json:"level"`
+		Message struct {
+			Text string `json:"text"`
+		} `json:"message"`
+		Locations []location `json:"locations"`
+	}
+	type rule struct {
+		ID string `json:"id"`
+	}
+	type run struct {
+		Tool struct {
+			Driver struct {
+				Name  string `json:"name"`
+				Rules []rule `json:"rules"`
+			} `json:"driver"`
+		} `json:"tool"`
+		Results []result `json:"results"`
+	}
+
+	levels := map[string]string{"error": "error", "warning": "warning", "info": "note"}
+
+	runs := []*run{}
+	byLinter := map[string]*run{}
+	ruleSeen := map[string]bool{}
+	for _, issue := range issues {
+		r, present := byLinter[issue.Linter]
+		if !present {
+			r = &run{Results: []result{}}
+			r.Tool.Driver.Name = issue.Linter
+			r.Tool.Driver.Rules = []rule{}
+			byLinter[issue.Linter] = r
+			runs = append(runs, r)
+		}
+		if issue.Rule != "" && !ruleSeen[issue.Linter+" "+issue.Rule] {
+			ruleSeen[issue.Linter+" "+issue.Rule] = true
+			r.Tool.Driver.Rules = append(r.Tool.Driver.Rules, rule{issue.Rule})
+		}
+
+		res := result{RuleID: issue.Rule, Level: levels[issue.Severity]}
+		if res.Level == "" {
+			res.Level = "warning"
+		}
+		res.Message.Text = issue.Message
+		var loc location
+		loc.PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(issue.File)
+		loc.PhysicalLocation.Region = region{issue.Line, issue.Column}
+		res.Locations = []location{loc}
+		r.Results = append(r.Results, res)
+	}
+
+	doc := map[string]interface{}{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs":    runs,
+	}
+	return writeJSON(filename, doc)
+}
+
+// WriteCheckstyle writes the issues as a Checkstyle XML report
+func WriteCheckstyle(filename string, issues []LintIssue) error {
+	type xmlError struct {
+		Line     int    `xml:"line,attr"`
+		Column   int    `xml:"column,attr,omitempty"`
+		Severity string `xml:"severity,attr"`
+		Message  string `xml:"message,attr"`
+		Source   string `xml:"source,attr"`
+	}
+	type xmlFile struct {
+		Name   string     `xml:"name,attr"`
+		Errors []xmlError `xml:"error"`
+	}
+	type checkstyle struct {
+		XMLName xml.Name   `xml:"checkstyle"`
+		Version string     `xml:"version,attr"`
+		Files   []*xmlFile `xml:"file"`
+	}
+
+	doc := checkstyle{Version: "4.3"}
+	files := map[string]*xmlFile{}
+	for _, issue := range issues {
+		f, present := files[issue.File]
+		if !present {
+			f = &xmlFile{Name: filepath.ToSlash(issue.File)}
+			files[issue.File] = f
+			doc.Files = append(doc.Files, f)
+		}
+		source := issue.Linter
+		if issue.Rule != "" {
+			source += "." + issue.Rule
+		}
+		f.Errors = append(f.Errors, xmlError{issue.Line, issue.Column, issue.Severity, issue.Message, source})
+	}
+	sort.Slice(doc.Files, func(i, j int) bool { return doc.Files[i].Name < doc.Files[j].Name })
+
+	return writeXML(filename, doc)
+}
+
+// WriteCodeQuality writes the issues as a GitLab Code Quality report
+func WriteCodeQuality(filename string, issues []LintIssue) error {
+	type lines struct {
+		Begin int `json:"begin"`
+	}
+	type location struct {
+		Path  string `json:"path"`
+		Lines lines  `json:"lines"`
+	}
+	type entry struct {
+		Description string   `json:"description"`
+		CheckName   string   `json:"check_name"`
+		Fingerprint string   `json:"fingerprint"`
+		Severity    string   `json:"severity"`
+		Location    location `json:"location"`
+	}
+
+	severities := map[string]string{"error": "major", "warning": "minor", "info": "info"}
+
+	entries := []entry{}
+	for _, issue := range issues {
+		check := issue.Linter
+		if issue.Rule != "" {
+			check += " " + issue.Rule
+		}
+		severity := severities[issue.Severity]
+		if severity == "" {
+			severity = "minor"
+		}
+		// the fingerprint identifies the issue between pipelines
+		fingerprint := fmt.Sprintf("%x", md5.Sum([]byte(check+"|"+issue.File+"|"+issue.Message)))
+		entries = append(entries, entry{issue.Message, check, fingerprint, severity,
+			location{filepath.ToSlash(issue.File), lines{issue.Line}}})
+	}
+	return writeJSON(filename, entries)
+}
+
+func writeXML(filename string, doc interface{}) error {
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
@@ -0,0 +1,251 @@
+package mgl
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Module holds a Go module embedded in a binary
+type Module struct {
+	Path    string
+	Version string
+	Sum     string
+}
+
+// BinaryModules holds the module information embedded in a Go binary
+type BinaryModules struct {
+	GoVersion string
+	Path      string // main package path
+	Main      Module
+	Deps      []Module
+	Settings  map[string]string // build settings (GOOS, GOARCH, vcs.revision...)
+}
+
+// severity levels, from the lowest to the highest
+var severities = []string{"negligible", "low", "medium", "high", "critical"}
+
+// ReadModules reads the module information of a Go binary with go version -m,
+// which works offline
+func (c *MageLibrary) ReadModules(binary string) (*BinaryModules, error) {
+	out, err := c.env.ExecOutput(c.env.GoCmd(), "version", "-m", binary)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read modules of %s: %v", binary, err)
+	}
+
+	bin := &BinaryModules{Settings: map[string]string{}}
+	for i, line := range strings.Split(out, "\n") {
+		if i == 0 {
+			if j := strings.LastIndex(line, ": "); j >= 0 {
+				bin.GoVersion = strings.TrimSpace(line[j+2:])
+			}
+			continue
+		}
+		fields := strings.Split(strings.TrimPrefix(line, "\t"), "\t")
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "path":
+			bin.Path = fields[1]
+		case "mod":
+			bin.Main = toModule(fields[1:])
+		case "dep":
+			bin.Deps = append(bin.Deps, toModule(fields[1:]))
+		case "=>":
+			// replacement of the previous dependency
+			if n := len(bin.Deps); n > 0 {
+				bin.Deps[n-1] = toModule(fields[1:])
+			}
+		case "build":
+			if kv := strings.SplitN(fields[1], "=", 2); len(kv) == 2 {
+				bin.Settings[kv[0]] = kv[1]
+			}
+		}
+	}
+	return bin, nil
+}
+
+func toModule(fields []string) Module {
+	m := Module{Path: fields[0]}
+	if len(fields) > 1 {
+		m.Version = fields[1]
+	}
+	if len(fields) > 2 {
+		m.Sum = fields[2]
+	}
+	return m
+}
+
+// purl returns the package URL of a Go module
+func (m Module) purl() string {
+	if m.Version == "" || m.Version == "(devel)" {
+		return "pkg:golang/" + m.Path
+	}
+	return "pkg:golang/" + m.Path + "@" + m.Version
+}
+
+// WriteCycloneDX writes a CycloneDX 1.4 JSON document describing the binary
+func WriteCycloneDX(filename, name, version string, bin *BinaryModules) error {
+	type component struct {
+		BomRef  string `json:"bom-ref"`
+		Type    string `json:"type"`
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+		Purl    string `json:"purl"`
+	}
+	type property struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	type dependency struct {
+		Ref       string   `json:"ref"`
+		DependsOn []string `json:"dependsOn"`
+	}
+
+	main := component{BomRef: bin.Main.purl(), Type: "application", Name: name, Version: version, Purl: bin.Main.purl()}
+	deps := dependency{Ref: main.BomRef, DependsOn: []string{}}
+	components := []component{}
+	for _, dep := range bin.Deps {
+		components = append(components, component{BomRef: dep.purl(), Type: "library", Name: dep.Path, Version: dep.Version, Purl: dep.purl()})
+		deps.DependsOn = append(deps.DependsOn, dep.purl())
+	}
+
+	doc := map[string]interface{}{
+		"bomFormat":    "CycloneDX",
+		"specVersion":  "1.4",
+		"serialNumber": "urn:uuid:" + newUUID(),
+		"version":      1,
+		"metadata": map[string]interface{}{
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+			"tools":     []map[string]string{{"vendor": "voyages-sncf-technologies", "name": "mageproj"}},
+			"component": main,
+			"properties": []property{
+				{"go:version", bin.GoVersion},
+				{"go:os", bin.Settings["GOOS"]},
+				{"go:arch", bin.Settings["GOARCH"]},
+			},
+		},
+		"components":   components,
+		"dependencies": []dependency{deps},
+	}
+	return writeJSON(filename, doc)
+}
+
+// WriteSPDX writes a SPDX 2.3 JSON document describing the binary
+func WriteSPDX(filename, name, version string, bin *BinaryModules) error {
+	type externalRef struct {
+		Category string `json:"referenceCategory"`
+		Type     string `json:"referenceType"`
+		Locator  string `json:"referenceLocator"`
+	}
+	type pkg struct {
+		SPDXID           string        `json:"SPDXID"`
+		Name             string        `json:"name"`
+		VersionInfo      string        `json:"versionInfo,omitempty"`
+		DownloadLocation string        `json:"downloadLocation"`
+		FilesAnalyzed    bool          `json:"filesAnalyzed"`
+		ExternalRefs     []externalRef `json:"externalRefs"`
+	}
+	type relationship struct {
+		Element string `json:"spdxElementId"`
+		Type    string `json:"relationshipType"`
+		Related string `json:"relatedSpdxElement"`
+	}
+
+	purlRef := func(m Module) []externalRef {
+		return []externalRef{{"PACKAGE-MANAGER", "purl", m.purl()}}
+	}
+
+	packages := []pkg{{SPDXID: "SPDXRef-Package-0", Name: name, VersionInfo: version,
+		DownloadLocation: "NOASSERTION", ExternalRefs: purlRef(bin.Main)}}
+	relationships := []relationship{{"SPDXRef-DOCUMENT", "DESCRIBES", "SPDXRef-Package-0"}}
+	for i, dep := range bin.Deps {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i+1)
+		packages = append(packages, pkg{SPDXID: id, Name: dep.Path, VersionInfo: dep.Version,
+			DownloadLocation: "NOASSERTION", ExternalRefs: purlRef(dep)})
+		relationships = append(relationships, relationship{"SPDXRef-Package-0", "DEPENDS_ON", id})
+	}
+
+	doc := map[string]interface{}{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              name + "-" + version,
+		"documentNamespace": "https://spdx.org/spdxdocs/" + name + "-" + version + "-" + newUUID(),
+		"creationInfo": map[string]interface{}{
+			"created":  time.Now().UTC().Format(time.RFC3339),
+			"creators": []string{"Tool: mageproj"},
+		},
+		"packages":      packages,
+		"relationships": relationships,
+	}
+	return writeJSON(filename, doc)
+}
+
+// ScanSBOM runs a vulnerability scanner (grype or trivy) on a CycloneDX document,
+// with its local database only. It fails if a vulnerability has a severity
+// equal or above the given one (negligible, low, medium, high or critical).
+func (c *MageLibrary) ScanSBOM(scanner, filename, severity string) error {
+	level := -1
+	for i, s := range severities {
+		if s == strings.ToLower(severity) {
+			level = i
+		}
+	}
+	if level < 0 {
+		return fmt.Errorf("unknown severity %q (one of %s)", severity, strings.Join(severities, ", "))
+	}
+
+	var cmd *exec.Cmd
+	switch scanner {
+	case "grype":
+		env := c.env.With(Env{"GRYPE_DB_AUTO_UPDATE": "false"})
+		cmd = env.Command("grype", "sbom:"+filename, "--fail-on", severities[level])
+	case "trivy":
+		var levels []string
+		for _, s := range severities[level:] {
+			if s != "negligible" {
+				levels = append(levels, strings.ToUpper(s))
+			}
+		}
+		cmd = c.env.Command("trivy", "sbom", "--skip-db-update", "--offline-scan", "--exit-code", "1",
+			"--severity", strings.Join(levels, ","), filename)
+	default:
+		return fmt.Errorf("unknown scanner %q (grype or trivy)", scanner)
+	}
+
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("%s found vulnerabilities of severity %s or above in %s", scanner, severities[level], filename)
+		}
+		return fmt.Errorf("unable to run %s: %v", scanner, err)
+	}
+	return nil
+}
+
+func writeJSON(filename string, doc interface{}) error {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
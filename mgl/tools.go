@@ -0,0 +1,199 @@
+package mgl
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+)
+
+// Tool holds a Go tool installed by InstallDeps
+type Tool struct {
+	Name    string // binary name
+	Package string // main package to go install
+	Version string // module version (e.g. v0.24.0)
+}
+
+// DefaultTools are the tools known by InstallDeps, with their pinned versions
+var DefaultTools = map[string]Tool{
+	"goimports":       {"goimports", "golang.org/x/tools/cmd/goimports", "v0.24.0"},
+	LinterStaticcheck: {LinterStaticcheck, "honnef.co/go/tools/cmd/staticcheck", "v0.5.1"},
+	LinterRevive:      {LinterRevive, "github.com/mgechev/revive", "v1.3.9"},
+	LinterGolangCI:    {LinterGolangCI, "github.com/golangci/golangci-lint/cmd/golangci-lint", "v1.60.3"},
+}
+
+// ParseTool parses a tool given as package@version, named after the last element of the package
+func ParseTool(spec string) (Tool, error) {
+	parts := strings.SplitN(spec, "@", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return Tool{}, fmt.Errorf("tool %q is not given as package@version", spec)
+	}
+	return Tool{Name: path.Base(parts[0]), Package: parts[0], Version: parts[1]}, nil
+}
+
+// WithTools adds the tools to the manifest of InstallDeps, overriding the ones with the same name
+func WithTools(val ...Tool) MageLibraryOption {
+	return func(c *MageLibrary) {
+		c.tools = append(c.tools, val...)
+	}
+}
+
+// WithToolsDir sets toolsDir to value, the directory where InstallDeps installs the tools
+func WithToolsDir(val string) MageLibraryOption {
+	return func(c *MageLibrary) {
+		c.toolsDir = val
+	}
+}
+
+// ToolsDir returns the directory where InstallDeps installs the tools, .mageproj/bin
+// in workdir by default
+func (c *MageLibrary) ToolsDir() string {
+	if c.toolsDir != "" {
+		return c.toolsDir
+	}
+	return filepath.Join(c.workdir, ".mageproj", "bin")
+}
+
+// Tools returns the manifest of the tools needed: goimports and the linters used,
+// at their default versions, the tools imported by tools.go in workdir, at the
+// version required by go.mod, and the tools given by WithTools
+func (c *MageLibrary) Tools() ([]Tool, error) {
+	var names []string
+	tools := map[string]Tool{}
+	add := func(t Tool) {
+		if _, present := tools[t.Name]; !present {
+			names = append(names, t.Name)
+		}
+		tools[t.Name] = t
+	}
+
+	add(DefaultTools["goimports"])
+	for _, linter := range c.linters {
+		if t, known := DefaultTools[linter]; known {
+			add(t)
+		}
+	}
+
+	fromFile, err := c.toolsFromFile(filepath.Join(c.workdir, "tools.go"))
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range fromFile {
+		add(t)
+	}
+	for _, t := range c.tools {
+		add(t)
+	}
+
+	result := make([]Tool, 0, len(names))
+	for _, name := range names {
+		result = append(result, tools[name])
+	}
+	return result, nil
+}
+
+// toolsFromFile returns the tools imported for side effects by a tools.go file, if any
+func (c *MageLibrary) toolsFromFile(filename string) ([]Tool, error) {
+	if !fileExists(filename) {
+		return nil, nil
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), filename, nil, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	var tools []Tool
+	for _, imp := range file.Imports {
+		if imp.Name == nil || imp.Name.Name != "_" {
+			continue
+		}
+		pkg, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		version, err := c.env.ExecOutputIn(c.workdir, c.env.GoCmd(), "list", "-tags", "tools", "-f", "{{.Module.Version}}", pkg)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find the version of tool %s required by go.mod: %v", pkg, err)
+		}
+		tools = append(tools, Tool{Name: path.Base(pkg), Package: pkg, Version: util.TrimString(version)})
+	}
+	return tools, nil
+}
+
+// toolBinary returns the path of the binary of the tool, installed in a directory per version
+func (c *MageLibrary) toolBinary(t Tool) string {
+	name := t.Name
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return filepath.Join(c.ToolsDir(), t.Name+"@"+t.Version, name)
+}
+
+// InstallDeps installs the tools of the manifest (see Tools) into the tools dir,
+// unless already installed at the same version, so that no network is needed
+// once the tools dir is filled
+func (c *MageLibrary) InstallDeps() error {
+	tools, err := c.Tools()
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tools {
+		bin := c.toolBinary(t)
+		if fileExists(bin) {
+			util.Logf("Using %s %s from %s", t.Name, t.Version, bin)
+			continue
+		}
+
+		gobin, err := filepath.Abs(filepath.Dir(bin))
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(gobin, 0755); err != nil {
+			return err
+		}
+		util.AlwaysLogf("Installing %s %s", t.Name, t.Version)
+		// GOFLAGS of the project (e.g. -mod=vendor) do not apply to tools
+		env := c.env.With(Env{"GOBIN": gobin, "GOFLAGS": ""})
+		if err := env.RunCmdStreamedIn(c.workdir, env.GoCmd(), "install", t.Package+"@"+t.Version); err != nil {
+			os.RemoveAll(gobin)
+			return fmt.Errorf("unable to install %s %s: %v", t.Name, t.Version, err)
+		}
+	}
+	return nil
+}
+
+// toolsEnv returns env with the directories of the installed tools first in PATH
+func (c *MageLibrary) toolsEnv() Env {
+	tools, err := c.Tools()
+	if err != nil {
+		return c.env
+	}
+
+	var dirs []string
+	for _, t := range tools {
+		if bin := c.toolBinary(t); fileExists(bin) {
+			dir, err := filepath.Abs(filepath.Dir(bin))
+			if err == nil {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	if len(dirs) == 0 {
+		return c.env
+	}
+	dirs = append(dirs, c.env.Get("PATH"))
+	return c.env.With(Env{"PATH": strings.Join(dirs, string(os.PathListSeparator))})
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
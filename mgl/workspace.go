@@ -0,0 +1,202 @@
+package mgl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+)
+
+// WorkspaceModule holds a Go module of the workspace
+type WorkspaceModule struct {
+	Path     string   // module path
+	Dir      string   // directory, relative to workdir ("." for the root module)
+	Requires []string // paths of the workspace modules it requires
+}
+
+// WorkspaceModules returns the Go modules of workdir: the ones used by go.work if
+// any, otherwise the ones whose go.mod is found in workdir or its subdirectories
+// (vendor, testdata, hidden and _ prefixed directories excepted)
+func (c *MageLibrary) WorkspaceModules() ([]WorkspaceModule, error) {
+	var dirs []string
+
+	work := filepath.Join(c.workdir, "go.work")
+	if _, err := os.Stat(work); err == nil {
+		out, err := c.env.ExecOutputIn(c.workdir, c.env.GoCmd(), "work", "edit", "-json", work)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %v", work, err)
+		}
+		var gowork struct {
+			Use []struct {
+				DiskPath string
+			}
+		}
+		if err := json.Unmarshal([]byte(out), &gowork); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", work, err)
+		}
+		for _, use := range gowork.Use {
+			dir, err := c.relDir(use.DiskPath)
+			if err != nil {
+				return nil, err
+			}
+			dirs = append(dirs, dir)
+		}
+	} else {
+		err := filepath.Walk(c.workdir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			name := info.Name()
+			if info.IsDir() && path != c.workdir &&
+				(name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			if !info.IsDir() && name == "go.mod" {
+				dir, err := filepath.Rel(c.workdir, filepath.Dir(path))
+				if err != nil {
+					return err
+				}
+				dirs = append(dirs, dir)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var modules []WorkspaceModule
+	for _, dir := range dirs {
+		gomod := filepath.Join(c.workdir, dir, "go.mod")
+		out, err := c.env.ExecOutputIn(c.workdir, c.env.GoCmd(), "mod", "edit", "-json", gomod)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %v", gomod, err)
+		}
+		var mod struct {
+			Module struct {
+				Path string
+			}
+			Require []struct {
+				Path string
+			}
+		}
+		if err := json.Unmarshal([]byte(out), &mod); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", gomod, err)
+		}
+		m := WorkspaceModule{Path: mod.Module.Path, Dir: filepath.ToSlash(dir)}
+		for _, req := range mod.Require {
+			m.Requires = append(m.Requires, req.Path)
+		}
+		modules = append(modules, m)
+	}
+
+	// only the requirements between modules of the workspace are kept
+	paths := map[string]bool{}
+	for _, m := range modules {
+		paths[m.Path] = true
+	}
+	for i := range modules {
+		var requires []string
+		for _, req := range modules[i].Requires {
+			if paths[req] {
+				requires = append(requires, req)
+			}
+		}
+		modules[i].Requires = requires
+	}
+
+	sort.Slice(modules, func(i, j int) bool { return modules[i].Dir < modules[j].Dir })
+	return modules, nil
+}
+
+// relDir returns the directory relative to workdir
+func (c *MageLibrary) relDir(dir string) (string, error) {
+	if !filepath.IsAbs(dir) {
+		return filepath.Clean(dir), nil
+	}
+	workdir, err := filepath.Abs(c.workdir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(workdir, dir)
+}
+
+// AffectedModules returns the modules having files changed since the merge base
+// of base and HEAD (committed, uncommitted or untracked), and the modules requiring
+// them. All the modules are affected when go.work changes.
+func (c *MageLibrary) AffectedModules(modules []WorkspaceModule, base string) ([]WorkspaceModule, error) {
+	gitDir := filepath.Join(c.Workdir(), ".git")
+	git := func(args ...string) (string, error) {
+		return c.env.ExecOutput(c.env.GitCmd(), append([]string{"--git-dir", gitDir, "--work-tree", c.workdir}, args...)...)
+	}
+
+	mergeBase, err := git("merge-base", base, "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the merge base of %s and HEAD: %v", base, err)
+	}
+	// file names are NUL-terminated, as they may hold spaces
+	changed, err := git("diff", "--name-only", "-z", util.TrimString(mergeBase))
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := git("ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+
+	affected := map[string]bool{}
+	for _, file := range strings.Split(changed+"\x00"+untracked, "\x00") {
+		if file == "" {
+			continue
+		}
+		if file == "go.work" || file == "go.work.sum" {
+			return modules, nil
+		}
+		if m := moduleOf(modules, file); m != nil {
+			affected[m.Path] = true
+		}
+	}
+
+	// modules requiring an affected module are affected too
+	for again := true; again; {
+		again = false
+		for _, m := range modules {
+			if affected[m.Path] {
+				continue
+			}
+			for _, req := range m.Requires {
+				if affected[req] {
+					affected[m.Path] = true
+					again = true
+					break
+				}
+			}
+		}
+	}
+
+	var result []WorkspaceModule
+	for _, m := range modules {
+		if affected[m.Path] {
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+
+// moduleOf returns the module holding the file (slash separated, relative to workdir),
+// nil if none
+func moduleOf(modules []WorkspaceModule, file string) *WorkspaceModule {
+	var owner *WorkspaceModule
+	for i, m := range modules {
+		if m.Dir == "." || file == m.Dir || strings.HasPrefix(file, m.Dir+"/") {
+			if owner == nil || len(m.Dir) > len(owner.Dir) || owner.Dir == "." {
+				owner = &modules[i]
+			}
+		}
+	}
+	return owner
+}
@@ -0,0 +1,38 @@
+package mgl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAffectedModules(t *testing.T) {
+	dir := gitRepo(t, []string{"v1.0.0"}, "")
+	git := func(args ...string) {
+		t.Helper()
+		if out, err := gitEnv.CommandIn(dir, "git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	writeFiles(t, dir, map[string]string{"a/my file.go": "package a\n"})
+	git("add", ".")
+	git("commit", "-q", "-m", "change a")
+	writeFiles(t, dir, map[string]string{"b c/new file.go": "package bc\n"})
+
+	modules := []WorkspaceModule{
+		{Path: "example.com/a", Dir: "a"},
+		{Path: "example.com/bc", Dir: "b c"},
+		{Path: "example.com/d", Dir: "d", Requires: []string{"example.com/bc"}},
+		{Path: "example.com/e", Dir: "e"},
+	}
+	affected, err := NewMageLibrary(dir).AffectedModules(modules, "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range affected {
+		got = append(got, m.Path)
+	}
+	if want := []string{"example.com/a", "example.com/bc", "example.com/d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AffectedModules() = %q, want %q", got, want)
+	}
+}
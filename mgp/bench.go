@@ -0,0 +1,173 @@
+package mgp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+	"github.com/voyages-sncf-technologies/mageproj/v2/mgl"
+)
+
+// significance level of the benchmark changes
+const benchAlpha = 0.05
+
+// WithBenchPattern sets benchPattern to value, the -bench pattern of the benchmarks
+// run by Bench (. by default), MAGEFILEP_BENCH variable taking precedence
+func WithBenchPattern(val string) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.benchPattern = val
+	}
+}
+
+// WithBenchCount sets benchCount to value, the number of times each benchmark runs
+// (5 by default), MAGEFILEP_BENCH_COUNT variable taking precedence
+func WithBenchCount(val int) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.benchCount = val
+	}
+}
+
+// WithBenchBaseline sets benchBaseline to value, the git ref (e.g. a tag) whose
+// benchmark results Bench compares to, MAGEFILEP_BENCH_BASELINE variable taking precedence
+func WithBenchBaseline(val string) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.benchBaseline = val
+	}
+}
+
+// WithBenchThreshold sets benchThreshold to value, the change (in percent, 10 by
+// default) above which a significant regression of a benchmark fails Bench
+func WithBenchThreshold(val float64) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.benchThreshold = val
+	}
+}
+
+// benchDir returns the directory of the benchmark results
+func (p *MageProject) benchDir() string {
+	return filepath.Join(p.mglib.Workdir(), p.buildDir, "bench")
+}
+
+// benchCountSetting returns the number of times each benchmark runs
+func (p *MageProject) benchCountSetting() (int, error) {
+	count := p.benchCount
+	if val := p.env.Get("MAGEFILEP_BENCH_COUNT"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return 0, fmt.Errorf("invalid MAGEFILEP_BENCH_COUNT %q: %v", val, err)
+		}
+		if n < 1 {
+			return 0, fmt.Errorf("invalid MAGEFILEP_BENCH_COUNT %q: not a positive count", val)
+		}
+		count = n
+	}
+	return count, nil
+}
+
+// Bench runs the benchmarks and stores their results into bench/<git rev>.txt in
+// build dir. With a baseline, they are compared to its results, as benchstat does,
+// failing if a benchmark significantly regresses by more than the threshold.
+func (p *MageProject) Bench() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
+	util.AlwaysLog("===== bench")
+
+	pattern := p.benchPattern
+	if val := p.env.Get("MAGEFILEP_BENCH"); val != "" {
+		pattern = val
+	}
+	count, err := p.benchCountSetting()
+	if err != nil {
+		return err
+	}
+	flags := []string{"-bench=" + pattern, "-benchmem", "-count=" + strconv.Itoa(count)}
+	if t := p.buildTags(); t != "" {
+		flags = append(flags, "-tags="+t)
+	}
+
+	git, _ := p.mglib.GitDetails()
+	rev := git.Rev
+	if rev == "" {
+		rev = "norev"
+	}
+	results, err := p.mglib.RunBenchmarks(filepath.Join(p.benchDir(), rev+".txt"), flags, p.testPackages())
+	if err != nil {
+		return err
+	}
+
+	baseline := p.benchBaseline
+	if val := p.env.Get("MAGEFILEP_BENCH_BASELINE"); val != "" {
+		baseline = val
+	}
+	if baseline == "" {
+		return printBenchmarks(results)
+	}
+
+	baseRev, err := p.mglib.ShortRev(baseline)
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(p.benchDir(), baseRev+".txt")
+	previous, err := mgl.ReadBenchmarks(file)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no benchmark results for baseline %s in %s, run Bench on it first", baseline, file)
+	}
+	if err != nil {
+		return err
+	}
+	util.AlwaysLogf("Comparing %s to baseline %s (%s)", rev, baseline, baseRev)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "benchmark\tunit\tbaseline\tresults\tdelta")
+	var regressions []string
+	for _, d := range mgl.CompareBenchmarks(previous, results) {
+		delta := "~"
+		if d.Significant(benchAlpha) {
+			delta = fmt.Sprintf("%+.2f%%", d.Change)
+			if d.Change > p.benchThreshold {
+				delta += " REGRESSION"
+				regressions = append(regressions, fmt.Sprintf("%s %s (%s)", d.Package, d.Name, d.Unit))
+			}
+		}
+		fmt.Fprintf(w, "%s %s\t%s\t%s\t%s\t%s (p=%.3f n=%d+%d)\n", d.Package, d.Name, d.Unit,
+			formatBench(d.Old), formatBench(d.New), delta, d.P, d.Old.N, d.New.N)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(regressions) > 0 {
+		return fmt.Errorf("%d benchmarks regressed by more than %.1f%%: %s", len(regressions), p.benchThreshold,
+			strings.Join(regressions, ", "))
+	}
+	return nil
+}
+
+// printBenchmarks prints the statistics of the benchmarks
+func printBenchmarks(results []*mgl.Benchmark) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "benchmark\tunit\tresults")
+	for _, b := range results {
+		units := make([]string, 0, len(b.Samples))
+		for unit := range b.Samples {
+			units = append(units, unit)
+		}
+		sort.Strings(units)
+		for _, unit := range units {
+			s := b.Summarize(unit)
+			fmt.Fprintf(w, "%s %s\t%s\t%s (n=%d)\n", b.Package, b.Name, unit, formatBench(s), s.N)
+		}
+	}
+	return w.Flush()
+}
+
+// formatBench formats the median and the spread of a benchmark
+func formatBench(s mgl.BenchSummary) string {
+	return fmt.Sprintf("%.4g ± %.0f%%", s.Median, s.Spread)
+}
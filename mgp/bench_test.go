@@ -0,0 +1,31 @@
+package mgp
+
+import (
+	"testing"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/mgl"
+)
+
+func TestBenchCountSetting(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		want    int
+		wantErr bool
+	}{
+		{"option", "", 3, false},
+		{"variable", "10", 10, false},
+		{"not a number", "ten", 0, true},
+		{"zero", "0", 0, true},
+		{"negative", "-2", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProject(t, WithBenchCount(3), WithEnv(mgl.Env{"MAGEFILEP_BENCH_COUNT": tt.env}))
+			got, err := p.benchCountSetting()
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("benchCountSetting() = %d, %v, want %d (error %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
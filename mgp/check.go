@@ -0,0 +1,200 @@
+package mgp
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/mgl"
+)
+
+// ConfigError reports all the problems found in the configuration of a MageProject
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+var (
+	// simplified grammar of github.com/distribution/reference
+	imageDomain    = `(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)*(?::[0-9]+)?)`
+	imageComponent = `[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*`
+	imageRegexp    = regexp.MustCompile(`^(?:` + imageDomain + `/)?` + imageComponent + `(?:/` + imageComponent + `)*$`)
+	registryRegexp = regexp.MustCompile(`^` + imageDomain + `$`)
+	tagRegexp      = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+	buildTagRegexp = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+
+	knownGOOS   = "aix android darwin dragonfly freebsd hurd illumos ios js linux netbsd openbsd plan9 solaris wasip1 windows zos"
+	knownGOARCH = "386 amd64 arm arm64 loong64 mips mips64 mips64le mipsle ppc64 ppc64le riscv64 s390x wasm"
+)
+
+// CheckConfig verifies every setting of the project, reporting all the problems
+// found together in a ConfigError
+func (p *MageProject) CheckConfig() error {
+	var problems []string
+	report := func(format string, v ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, v...))
+	}
+
+	if p.configErr != nil {
+		report("%v", p.configErr)
+	}
+
+	if p.projectName == "" {
+		report("project name is empty")
+	} else if strings.ContainsAny(p.projectName, `/\:*?"<>| `) {
+		report("project name %q is not a valid file name", p.projectName)
+	}
+	if p.packageName == "" {
+		report("package name is empty")
+	}
+	if p.mainPkg == "" {
+		report("main package is empty")
+	} else if filepath.IsAbs(p.mainPkg) {
+		report("main package %q must be relative to workdir", p.mainPkg)
+	}
+
+	if p.buildDir == "" {
+		report("build dir is empty")
+	} else if filepath.IsAbs(p.buildDir) {
+		report("build dir %q must be relative to workdir", p.buildDir)
+	} else {
+		for _, elem := range strings.Split(filepath.ToSlash(p.buildDir), "/") {
+			if elem == ".." {
+				report("build dir %q must not contain '..'", p.buildDir)
+				break
+			}
+		}
+		if filepath.Clean(p.buildDir) == "." {
+			report("build dir %q must not be workdir", p.buildDir)
+		}
+	}
+
+	if len(p.targets) == 0 {
+		report("no target to build")
+	}
+	for _, t := range p.targets {
+		if !knownValue(knownGOOS, t.goos) || !knownValue(knownGOARCH, t.goarch) {
+			report("target %q is not a valid goos/goarch", t.platform())
+		}
+	}
+
+	checkURL := func(name, val string) {
+		if val == "" {
+			return
+		}
+		u, err := url.Parse(val)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			report("%s %q is not an absolute http(s) URL", name, val)
+		}
+	}
+	checkURL("artifact URL", p.artifactURL)
+	checkURL("git URL", p.gitURL)
+
+	if p.dckRegistry != "" && !registryRegexp.MatchString(p.dckRegistry) {
+		report("docker registry %q is not a valid host[:port]", p.dckRegistry)
+	}
+	if p.dckImage != "" && !imageRegexp.MatchString(p.dckImage) {
+		report("docker image %q is not a valid image name (lowercase [a-z0-9._-] components separated by '/')", p.dckImage)
+	}
+	if !path.IsAbs(p.dckAppPath) {
+		report("docker app path %q must be absolute", p.dckAppPath)
+	}
+	for _, tag := range p.dckTags.Static {
+		if !tagRegexp.MatchString(tag) {
+			report("docker tag %q is not a valid tag", tag)
+		}
+	}
+	switch p.engineName {
+	case "", mgl.EngineDocker, mgl.EnginePodman, mgl.EngineBuildah:
+	default:
+		report("container engine %q is not one of docker, podman or buildah", p.engineName)
+	}
+
+	for _, linter := range p.linters {
+		if _, err := mgl.NewLinter(linter); err != nil {
+			report("%v", err)
+		}
+	}
+	if p.lintSeverity != "" && !knownValue("info warning error", strings.ToLower(p.lintSeverity)) {
+		report("lint severity %q is not one of info, warning or error", p.lintSeverity)
+	}
+	for _, tag := range p.buildTagList {
+		if !buildTagRegexp.MatchString(tag) {
+			report("build tag %q is not a valid tag", tag)
+		}
+	}
+	if !buildTagRegexp.MatchString(p.integrationTag) {
+		report("integration tag %q is not a valid tag", p.integrationTag)
+	}
+	switch p.testShuffle {
+	case "", "on", "off":
+	default:
+		if _, err := strconv.ParseInt(p.testShuffle, 10, 64); err != nil {
+			report("test shuffle %q is not one of on, off or a seed", p.testShuffle)
+		}
+	}
+	if p.testCount < 0 {
+		report("test count %d is negative", p.testCount)
+	}
+	if p.testRetries < 0 {
+		report("test retries %d is negative", p.testRetries)
+	}
+	if p.coverageMin < 0 || p.coverageMin > 100 {
+		report("coverage threshold %v is not a percentage between 0 and 100", p.coverageMin)
+	}
+	if p.benchCount <= 0 {
+		report("bench count %d is not positive", p.benchCount)
+	}
+	if p.benchThreshold < 0 {
+		report("bench threshold %v is negative", p.benchThreshold)
+	}
+	if p.fuzzTime <= 0 {
+		report("fuzz time %s is not positive", p.fuzzTime)
+	}
+	if p.fuzzParallel < 1 {
+		report("fuzz parallel %d is not positive", p.fuzzParallel)
+	}
+	if filepath.IsAbs(p.fuzzCorpusDir) {
+		report("fuzz corpus dir %q must be relative to workdir", p.fuzzCorpusDir)
+	}
+	for _, v := range []string{p.goMin, p.goMax} {
+		if v == "" {
+			continue
+		}
+		if _, err := mgl.ParseGoVersion(v); err != nil {
+			report("%v", err)
+		}
+	}
+	if min, max, err := p.goVersionRange(); err == nil && min != nil && max != nil && min.Compare(*max) >= 0 {
+		report("Go version range %s is empty", formatGoVersionRange(min, max))
+	}
+	if p.sbomScanner != "" {
+		if p.sbomScanner != "grype" && p.sbomScanner != "trivy" {
+			report("SBOM scanner %q is not one of grype or trivy", p.sbomScanner)
+		}
+		if !knownValue("negligible low medium high critical", strings.ToLower(p.sbomSeverity)) {
+			report("SBOM severity %q is not one of negligible, low, medium, high or critical", p.sbomSeverity)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+func knownValue(values, val string) bool {
+	for _, v := range strings.Fields(values) {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
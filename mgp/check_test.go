@@ -0,0 +1,129 @@
+package mgp
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/mgl"
+)
+
+// newTestProject returns a valid project in an empty workdir, with the options
+func newTestProject(t *testing.T, options ...MageProjectOption) *MageProject {
+	t.Helper()
+	return NewMageProject(t.TempDir(), "myapp", "mycompany.fr/myapp",
+		append([]MageProjectOption{WithEnv(mgl.Env{})}, options...)...)
+}
+
+func TestCheckConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []MageProjectOption
+		want    string // problem reported, none if empty
+	}{
+		{"valid", nil, ""},
+		{"valid settings", []MageProjectOption{WithBuildDir("out/bin"), WithTargets("linux/arm64", "windows/amd64"),
+			WithArtifactURL("https://artifactory.mycompany.fr/myapp"), WithGitURL("http://gitlab.mycompany.fr/myapp"),
+			WithDockerRegistry("registry.mycompany.fr:5000"), WithDockerImage("registry.mycompany.fr:5000/team/my-app"),
+			WithDockerTagPolicy(mgl.DockerTagPolicy{Static: []string{"stable_1.2"}}), WithContainerEngine("podman"),
+			WithLinters("staticcheck", "revive"), WithLintSeverity("warning"), WithTestShuffle("42"), WithTestCount(0),
+			WithCoverageThreshold(100), WithGoVersion("1.21", "1.23"), WithBuildTags("netgo", "osusergo"),
+			WithSBOMScanner("trivy", "HIGH")}, ""},
+
+		{"config file", []MageProjectOption{WithConfigFile("missing.yaml")}, "missing.yaml"},
+		{"empty project name", []MageProjectOption{func(p *MageProject) { p.projectName = "" }}, "project name is empty"},
+		{"project name not a file name", []MageProjectOption{func(p *MageProject) { p.projectName = "my app" }}, `project name "my app" is not a valid file name`},
+		{"empty package name", []MageProjectOption{func(p *MageProject) { p.packageName = "" }}, "package name is empty"},
+		{"absolute main package", []MageProjectOption{WithMainPackage("/src/cmd/app")}, `main package "/src/cmd/app" must be relative`},
+		{"empty build dir", []MageProjectOption{WithBuildDir("")}, "build dir is empty"},
+		{"absolute build dir", []MageProjectOption{WithBuildDir(filepath.Join(string(filepath.Separator), "tmp", "build"))}, "must be relative to workdir"},
+		{"build dir outside workdir", []MageProjectOption{WithBuildDir("../build")}, `build dir "../build" must not contain '..'`},
+		{"build dir is workdir", []MageProjectOption{WithBuildDir("./")}, `build dir "./" must not be workdir`},
+		{"no target", []MageProjectOption{WithTargets()}, "no target to build"},
+		{"bad goos", []MageProjectOption{WithTargets("linus/amd64")}, `target "linus/amd64" is not a valid goos/goarch`},
+		{"bad goarch", []MageProjectOption{WithTargets("linux/x64")}, `target "linux/x64" is not a valid goos/goarch`},
+		{"artifact URL without scheme", []MageProjectOption{WithArtifactURL("artifactory.mycompany.fr/myapp")}, `artifact URL "artifactory.mycompany.fr/myapp" is not an absolute http(s) URL`},
+		{"non-http git URL", []MageProjectOption{WithGitURL("ssh://git@gitlab.mycompany.fr/myapp")}, `git URL "ssh://git@gitlab.mycompany.fr/myapp" is not an absolute http(s) URL`},
+		{"bad registry", []MageProjectOption{WithDockerRegistry("https://registry.mycompany.fr")}, `docker registry "https://registry.mycompany.fr" is not a valid host[:port]`},
+		{"bad image", []MageProjectOption{WithDockerImage("registry.mycompany.fr/MyApp")}, `docker image "registry.mycompany.fr/MyApp" is not a valid image name`},
+		{"relative app path", []MageProjectOption{WithDockerAppPath("app")}, `docker app path "app" must be absolute`},
+		{"bad static tag", []MageProjectOption{WithDockerTagPolicy(mgl.DockerTagPolicy{Static: []string{"-latest"}})}, `docker tag "-latest" is not a valid tag`},
+		{"unknown engine", []MageProjectOption{WithContainerEngine("rkt")}, `container engine "rkt" is not one of docker, podman or buildah`},
+		{"unknown linter", []MageProjectOption{WithLinters("golint")}, `unknown linter "golint"`},
+		{"unknown lint severity", []MageProjectOption{WithLintSeverity("fatal")}, `lint severity "fatal" is not one of info, warning or error`},
+		{"bad build tag", []MageProjectOption{WithBuildTags("net-go")}, `build tag "net-go" is not a valid tag`},
+		{"empty integration tag", []MageProjectOption{WithIntegrationTag("")}, `integration tag "" is not a valid tag`},
+		{"unknown shuffle", []MageProjectOption{WithTestShuffle("random")}, `test shuffle "random" is not one of on, off or a seed`},
+		{"negative test count", []MageProjectOption{WithTestCount(-1)}, "test count -1 is negative"},
+		{"negative test retries", []MageProjectOption{WithTestRetries(-2)}, "test retries -2 is negative"},
+		{"negative coverage threshold", []MageProjectOption{WithCoverageThreshold(-1)}, "coverage threshold -1 is not a percentage"},
+		{"coverage threshold above 100", []MageProjectOption{WithCoverageThreshold(100.5)}, "coverage threshold 100.5 is not a percentage"},
+		{"zero bench count", []MageProjectOption{WithBenchCount(0)}, "bench count 0 is not positive"},
+		{"negative bench threshold", []MageProjectOption{WithBenchThreshold(-5)}, "bench threshold -5 is negative"},
+		{"zero fuzz time", []MageProjectOption{WithFuzzTime(0)}, "fuzz time 0s is not positive"},
+		{"zero fuzz parallel", []MageProjectOption{WithFuzzParallel(0)}, "fuzz parallel 0 is not positive"},
+		{"absolute fuzz corpus dir", []MageProjectOption{WithFuzzCorpusDir(filepath.Join(string(filepath.Separator), "tmp", "fuzz"))}, "must be relative to workdir"},
+		{"bad min Go version", []MageProjectOption{WithGoVersion("1.x", "")}, `invalid Go version "1.x"`},
+		{"bad max Go version", []MageProjectOption{WithGoVersion("", "latest")}, `invalid Go version "latest"`},
+		{"empty Go range", []MageProjectOption{WithGoVersion("1.22", "1.22")}, "Go version range >= 1.22, < 1.22 is empty"},
+		{"max Go version below library one", []MageProjectOption{WithGoVersion("", "1.16")}, "Go version range >= 1.17, < 1.16 is empty"},
+		{"unknown SBOM scanner", []MageProjectOption{WithSBOMScanner("clair", "high")}, `SBOM scanner "clair" is not one of grype or trivy`},
+		{"unknown SBOM severity", []MageProjectOption{WithSBOMScanner("grype", "urgent")}, `SBOM severity "urgent" is not one of`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newTestProject(t, tt.options...).CheckConfig()
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("CheckConfig() = %v, want no error", err)
+				}
+				return
+			}
+
+			var cfgErr *ConfigError
+			if !errors.As(err, &cfgErr) {
+				t.Fatalf("CheckConfig() = %v, want a *ConfigError", err)
+			}
+			if len(cfgErr.Problems) != 1 || !strings.Contains(cfgErr.Problems[0], tt.want) {
+				t.Errorf("CheckConfig() problems = %q, want one containing %q", cfgErr.Problems, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckConfigReportsAllProblems(t *testing.T) {
+	p := newTestProject(t, WithBuildDir("../build"), WithTargets("linux/x64"), WithContainerEngine("rkt"),
+		WithTestCount(-1), WithCoverageThreshold(200))
+	err := p.CheckConfig()
+
+	var cfgErr *ConfigError
+	if !errors.As(err, &cfgErr) {
+		t.Fatalf("CheckConfig() = %v, want a *ConfigError", err)
+	}
+	want := []string{"build dir", "target", "container engine", "test count", "coverage threshold"}
+	if len(cfgErr.Problems) != len(want) {
+		t.Fatalf("CheckConfig() problems = %q, want %d problems", cfgErr.Problems, len(want))
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(cfgErr.Problems[i], w) {
+			t.Errorf("problem %d = %q, want it about %s", i, cfgErr.Problems[i], w)
+		}
+		if !strings.Contains(err.Error(), cfgErr.Problems[i]) {
+			t.Errorf("Error() = %q, want it to contain %q", err.Error(), cfgErr.Problems[i])
+		}
+	}
+}
+
+func TestNewMageProjectE(t *testing.T) {
+	p, err := NewMageProjectE(t.TempDir(), "myapp", "mycompany.fr/myapp", WithEnv(mgl.Env{}))
+	if err != nil || p == nil {
+		t.Fatalf("NewMageProjectE() = %v, %v, want a project", p, err)
+	}
+
+	p, err = NewMageProjectE(t.TempDir(), "", "mycompany.fr/myapp", WithEnv(mgl.Env{}), WithLintSeverity("fatal"))
+	var cfgErr *ConfigError
+	if p != nil || !errors.As(err, &cfgErr) || len(cfgErr.Problems) != 2 {
+		t.Fatalf("NewMageProjectE() = %v, %v, want no project and a *ConfigError with 2 problems", p, err)
+	}
+}
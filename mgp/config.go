@@ -0,0 +1,391 @@
+package mgp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+	"github.com/voyages-sncf-technologies/mageproj/v2/mgl"
+)
+
+// configFiles are the configuration files looked up in workdir, in order
+var configFiles = []string{".mageproj.yaml", ".mageproj.yml", ".mageproj.toml"}
+
+// Config holds the MageProject settings which can be set by a configuration file.
+// Booleans and numbers are pointers, so that an explicit false or 0 overrides the
+// option given in code.
+type Config struct {
+	ProjectName  string          `yaml:"projectName,omitempty" toml:"projectName"`
+	PackageName  string          `yaml:"packageName,omitempty" toml:"packageName"`
+	MainPackage  string          `yaml:"mainPackage,omitempty" toml:"mainPackage"`
+	GroupName    string          `yaml:"groupName,omitempty" toml:"groupName"`
+	BuildDir     string          `yaml:"buildDir,omitempty" toml:"buildDir"`
+	Targets      []string        `yaml:"targets,omitempty" toml:"targets"`
+	LdFlags      string          `yaml:"ldFlags,omitempty" toml:"ldFlags"`
+	TestFlags    string          `yaml:"testFlags,omitempty" toml:"testFlags"`
+	BuildTags    []string        `yaml:"buildTags,omitempty" toml:"buildTags"`
+	Test         TestConfig      `yaml:"test,omitempty" toml:"test"`
+	BaseRef      string          `yaml:"baseRef,omitempty" toml:"baseRef"`
+	ImportsLocal string          `yaml:"importsLocal,omitempty" toml:"importsLocal"`
+	Lint         LintConfig      `yaml:"lint,omitempty" toml:"lint"`
+	Tools        []string        `yaml:"tools,omitempty" toml:"tools"`
+	Reports      *bool           `yaml:"reports,omitempty" toml:"reports"`
+	Coverage     CoverageConfig  `yaml:"coverage,omitempty" toml:"coverage"`
+	Bench        BenchConfig     `yaml:"bench,omitempty" toml:"bench"`
+	Fuzz         FuzzConfig      `yaml:"fuzz,omitempty" toml:"fuzz"`
+	GoVersion    GoVersionConfig `yaml:"goVersion,omitempty" toml:"goVersion"`
+	Docker       DockerConfig    `yaml:"docker,omitempty" toml:"docker"`
+	Artifact     ArtifactConfig  `yaml:"artifact,omitempty" toml:"artifact"`
+	ChangeLog    ChangeLogConfig `yaml:"changelog,omitempty" toml:"changelog"`
+}
+
+// TestConfig holds the go test settings of Config
+type TestConfig struct {
+	Race           *bool  `yaml:"race,omitempty" toml:"race"`
+	Short          *bool  `yaml:"short,omitempty" toml:"short"`
+	Shuffle        string `yaml:"shuffle,omitempty" toml:"shuffle"`
+	Count          *int   `yaml:"count,omitempty" toml:"count"`
+	Retries        *int   `yaml:"retries,omitempty" toml:"retries"`
+	IntegrationTag string `yaml:"integrationTag,omitempty" toml:"integrationTag"`
+}
+
+// LintConfig holds the linters settings of Config
+type LintConfig struct {
+	Linters  []string `yaml:"linters,omitempty" toml:"linters"`
+	Severity string   `yaml:"severity,omitempty" toml:"severity"`
+}
+
+// CoverageConfig holds the coverage settings of Config
+type CoverageConfig struct {
+	Enabled   *bool    `yaml:"enabled,omitempty" toml:"enabled"`
+	Threshold *float64 `yaml:"threshold,omitempty" toml:"threshold"`
+}
+
+// BenchConfig holds the benchmarks settings of Config
+type BenchConfig struct {
+	Pattern   string   `yaml:"pattern,omitempty" toml:"pattern"`
+	Count     *int     `yaml:"count,omitempty" toml:"count"`
+	Baseline  string   `yaml:"baseline,omitempty" toml:"baseline"`
+	Threshold *float64 `yaml:"threshold,omitempty" toml:"threshold"`
+}
+
+// FuzzConfig holds the fuzzing settings of Config
+type FuzzConfig struct {
+	Time      string `yaml:"time,omitempty" toml:"time"` // duration, e.g. 1m
+	Parallel  *int   `yaml:"parallel,omitempty" toml:"parallel"`
+	CorpusDir string `yaml:"corpusDir,omitempty" toml:"corpusDir"` // fuzz in build dir by default
+}
+
+// GoVersionConfig holds the Go versions required by Config
+type GoVersionConfig struct {
+	Min    string `yaml:"min,omitempty" toml:"min"` // go.mod version by default
+	Max    string `yaml:"max,omitempty" toml:"max"` // excluded
+	Select *bool  `yaml:"select,omitempty" toml:"select"`
+}
+
+// DockerConfig holds the Docker settings of Config
+type DockerConfig struct {
+	Registry    string           `yaml:"registry,omitempty" toml:"registry"`
+	Image       string           `yaml:"image,omitempty" toml:"image"`
+	AppPath     string           `yaml:"appPath,omitempty" toml:"appPath"`
+	BaseImage   string           `yaml:"baseImage,omitempty" toml:"baseImage"`
+	BuildFile   string           `yaml:"buildFile,omitempty" toml:"buildFile"`
+	BuildTarget string           `yaml:"buildTarget,omitempty" toml:"buildTarget"`
+	Engine      string           `yaml:"engine,omitempty" toml:"engine"`
+	Tags        *DockerTagConfig `yaml:"tags,omitempty" toml:"tags"`
+}
+
+// DockerTagConfig holds the Docker tag policy of Config (see mgl.DockerTagPolicy)
+type DockerTagConfig struct {
+	GitTag *bool    `yaml:"gitTag,omitempty" toml:"gitTag"`
+	SemVer *bool    `yaml:"semVer,omitempty" toml:"semVer"`
+	GitRev *bool    `yaml:"gitRev,omitempty" toml:"gitRev"`
+	Branch *bool    `yaml:"branch,omitempty" toml:"branch"`
+	Latest *bool    `yaml:"latest,omitempty" toml:"latest"`
+	Static []string `yaml:"static,omitempty" toml:"static"`
+}
+
+// ArtifactConfig holds the artifacts registry settings of Config
+type ArtifactConfig struct {
+	URL string `yaml:"url,omitempty" toml:"url"`
+}
+
+// ChangeLogConfig holds the ChangeLog settings of Config
+type ChangeLogConfig struct {
+	GitURL       string `yaml:"gitURL,omitempty" toml:"gitURL"`
+	Stats        *bool  `yaml:"stats,omitempty" toml:"stats"`
+	MergeCommits *bool  `yaml:"mergeCommits,omitempty" toml:"mergeCommits"`
+}
+
+// WithConfigFile sets the configuration file to load instead of looking for
+// .mageproj.yaml, .mageproj.yml or .mageproj.toml in workdir
+func WithConfigFile(val string) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.configFile = val
+	}
+}
+
+// LoadConfig reads a YAML or TOML (.toml extension) configuration file
+func LoadConfig(filename string) (*Config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	if strings.HasSuffix(filename, ".toml") {
+		err = toml.Unmarshal(data, cfg)
+	} else {
+		err = yaml.Unmarshal(data, cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration file %s: %v", filename, err)
+	}
+	return cfg, nil
+}
+
+// loadConfig applies the configuration file, if any, over the options given in code
+func (p *MageProject) loadConfig() error {
+	filename := p.configFile
+	if filename == "" {
+		for _, f := range configFiles {
+			path := filepath.Join(p.mglib.Workdir(), f)
+			if _, err := os.Stat(path); err == nil {
+				filename = path
+				break
+			}
+		}
+	}
+	if filename == "" {
+		return nil
+	}
+
+	cfg, err := LoadConfig(filename)
+	if err != nil {
+		return err
+	}
+	util.Logf("Using configuration file %s", filename)
+	p.configFile = filename
+
+	setString := func(dst *string, val string) {
+		if val != "" {
+			*dst = val
+		}
+	}
+	setBool := func(dst *bool, val *bool) {
+		if val != nil {
+			*dst = *val
+		}
+	}
+	setInt := func(dst *int, val *int) {
+		if val != nil {
+			*dst = *val
+		}
+	}
+	setFloat := func(dst *float64, val *float64) {
+		if val != nil {
+			*dst = *val
+		}
+	}
+	setString(&p.projectName, cfg.ProjectName)
+	setString(&p.packageName, cfg.PackageName)
+	setString(&p.mainPkg, cfg.MainPackage)
+	setString(&p.groupName, cfg.GroupName)
+	setString(&p.buildDir, cfg.BuildDir)
+	setString(&p.ldFlags, cfg.LdFlags)
+	setString(&p.testFlags, cfg.TestFlags)
+	if len(cfg.BuildTags) > 0 {
+		p.buildTagList = cfg.BuildTags
+	}
+	setBool(&p.testRace, cfg.Test.Race)
+	setBool(&p.testShort, cfg.Test.Short)
+	setString(&p.testShuffle, cfg.Test.Shuffle)
+	setInt(&p.testCount, cfg.Test.Count)
+	setInt(&p.testRetries, cfg.Test.Retries)
+	setString(&p.integrationTag, cfg.Test.IntegrationTag)
+	setString(&p.baseRef, cfg.BaseRef)
+	if cfg.ImportsLocal != "" {
+		p.importsLocal = cfg.ImportsLocal
+		mgl.WithImportsLocal(cfg.ImportsLocal)(p.mglib)
+	}
+	setString(&p.dckRegistry, cfg.Docker.Registry)
+	setString(&p.dckImage, cfg.Docker.Image)
+	setString(&p.dckAppPath, cfg.Docker.AppPath)
+	setString(&p.dckBase, cfg.Docker.BaseImage)
+	setString(&p.dckBuildFile, cfg.Docker.BuildFile)
+	setString(&p.dckBuildTarget, cfg.Docker.BuildTarget)
+	setString(&p.engineName, cfg.Docker.Engine)
+	setString(&p.artifactURL, cfg.Artifact.URL)
+	setString(&p.gitURL, cfg.ChangeLog.GitURL)
+
+	if len(cfg.Lint.Linters) > 0 {
+		p.linters = cfg.Lint.Linters
+		mgl.WithLinters(cfg.Lint.Linters...)(p.mglib)
+	}
+	if cfg.Lint.Severity != "" {
+		p.lintSeverity = cfg.Lint.Severity
+		mgl.WithLintSeverity(cfg.Lint.Severity)(p.mglib)
+	}
+	for _, spec := range cfg.Tools {
+		tool, err := mgl.ParseTool(spec)
+		if err != nil {
+			return err
+		}
+		p.tools = append(p.tools, tool)
+		mgl.WithTools(tool)(p.mglib)
+	}
+	setBool(&p.reports, cfg.Reports)
+	setBool(&p.coverage, cfg.Coverage.Enabled)
+	setFloat(&p.coverageMin, cfg.Coverage.Threshold)
+	setString(&p.benchPattern, cfg.Bench.Pattern)
+	setInt(&p.benchCount, cfg.Bench.Count)
+	setString(&p.benchBaseline, cfg.Bench.Baseline)
+	setFloat(&p.benchThreshold, cfg.Bench.Threshold)
+	if cfg.Fuzz.Time != "" {
+		d, err := time.ParseDuration(cfg.Fuzz.Time)
+		if err != nil {
+			return fmt.Errorf("invalid fuzz time %q: %v", cfg.Fuzz.Time, err)
+		}
+		p.fuzzTime = d
+	}
+	setInt(&p.fuzzParallel, cfg.Fuzz.Parallel)
+	setString(&p.fuzzCorpusDir, cfg.Fuzz.CorpusDir)
+	setString(&p.goMin, cfg.GoVersion.Min)
+	setString(&p.goMax, cfg.GoVersion.Max)
+	setBool(&p.goSelect, cfg.GoVersion.Select)
+	if len(cfg.Targets) > 0 {
+		WithTargets(cfg.Targets...)(p)
+	}
+	if t := cfg.Docker.Tags; t != nil {
+		setBool(&p.dckTags.GitTag, t.GitTag)
+		setBool(&p.dckTags.SemVer, t.SemVer)
+		setBool(&p.dckTags.GitRev, t.GitRev)
+		setBool(&p.dckTags.Branch, t.Branch)
+		setBool(&p.dckTags.Latest, t.Latest)
+		if len(t.Static) > 0 {
+			p.dckTags.Static = t.Static
+		}
+	}
+	if cfg.ChangeLog.Stats != nil {
+		mgl.WithChangeLogStats(*cfg.ChangeLog.Stats)(p.mglib)
+	}
+	if cfg.ChangeLog.MergeCommits != nil {
+		mgl.WithMergeCommits(*cfg.ChangeLog.MergeCommits)(p.mglib)
+	}
+	return nil
+}
+
+// Config prints the effective configuration, merging code options, configuration
+// file and environment variables
+func (p *MageProject) Config() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
+
+	test := TestConfig{Race: boolPtr(p.testRace), Short: boolPtr(p.testShort), Shuffle: p.testShuffle,
+		Count: intPtr(p.testCount), Retries: intPtr(p.testRetries), IntegrationTag: p.integrationTag}
+	bench := BenchConfig{Pattern: p.benchPattern, Count: intPtr(p.benchCount), Baseline: p.benchBaseline,
+		Threshold: floatPtr(p.benchThreshold)}
+	cfg := Config{
+		ProjectName:  p.projectName,
+		PackageName:  p.packageName,
+		MainPackage:  p.mainPkg,
+		GroupName:    p.groupName,
+		BuildDir:     p.buildDir,
+		LdFlags:      p.ldFlags,
+		TestFlags:    p.testFlags,
+		BuildTags:    p.buildTagList,
+		Test:         test,
+		BaseRef:      p.baseRef,
+		ImportsLocal: p.importsLocal,
+		Lint:         LintConfig{Linters: p.linters, Severity: p.lintSeverity},
+		Coverage:     CoverageConfig{Enabled: boolPtr(p.coverage), Threshold: floatPtr(p.coverageMin)},
+		Bench:        bench,
+		Fuzz:         FuzzConfig{Time: p.fuzzTime.String(), Parallel: intPtr(p.fuzzParallel), CorpusDir: p.fuzzCorpusDir},
+		GoVersion:    GoVersionConfig{Min: p.goMin, Max: p.goMax},
+		Docker: DockerConfig{
+			Registry:    p.dckRegistry,
+			Image:       p.dckImage,
+			AppPath:     p.dckAppPath,
+			BaseImage:   p.dckBase,
+			BuildFile:   p.dckBuildFile,
+			BuildTarget: p.dckBuildTarget,
+			Engine:      p.engineName,
+			Tags: &DockerTagConfig{GitTag: boolPtr(p.dckTags.GitTag), SemVer: boolPtr(p.dckTags.SemVer),
+				GitRev: boolPtr(p.dckTags.GitRev), Branch: boolPtr(p.dckTags.Branch), Latest: boolPtr(p.dckTags.Latest),
+				Static: p.dckTags.Static},
+		},
+		Artifact:  ArtifactConfig{URL: p.artifactURL},
+		ChangeLog: ChangeLogConfig{GitURL: p.gitURL},
+	}
+	for _, t := range p.targets {
+		cfg.Targets = append(cfg.Targets, t.platform())
+	}
+	for _, t := range p.tools {
+		cfg.Tools = append(cfg.Tools, t.Package+"@"+t.Version)
+	}
+
+	// environment variables take precedence
+	if engine := p.env.Get("MAGEFILEP_CONTAINER_ENGINE"); engine != "" {
+		cfg.Docker.Engine = engine
+	}
+	if ref := p.env.Get("MAGEFILEP_BASE_REF"); ref != "" {
+		cfg.BaseRef = ref
+	}
+	cfg.Test.Race = boolPtr(p.envBool("MAGEFILEP_TEST_RACE", p.testRace))
+	cfg.Test.Short = boolPtr(p.shortTests())
+	if shuffle := p.env.Get("MAGEFILEP_TEST_SHUFFLE"); shuffle != "" {
+		cfg.Test.Shuffle = shuffle
+	}
+	if count, err := strconv.Atoi(p.env.Get("MAGEFILEP_TEST_COUNT")); err == nil {
+		cfg.Test.Count = intPtr(count)
+	}
+	cfg.Test.Retries = intPtr(p.retries())
+	if pattern := p.env.Get("MAGEFILEP_BENCH"); pattern != "" {
+		cfg.Bench.Pattern = pattern
+	}
+	if count, err := p.benchCountSetting(); err == nil {
+		cfg.Bench.Count = intPtr(count)
+	}
+	if baseline := p.env.Get("MAGEFILEP_BENCH_BASELINE"); baseline != "" {
+		cfg.Bench.Baseline = baseline
+	}
+	if fuzztime, parallel, err := p.fuzzSettings(); err == nil {
+		cfg.Fuzz = FuzzConfig{Time: fuzztime.String(), Parallel: intPtr(parallel), CorpusDir: p.corpusDir()}
+	}
+	cfg.GoVersion.Select = boolPtr(p.envBool("MAGEFILEP_GO_SELECT", p.goSelect))
+	cfg.Reports = boolPtr(p.reportsEnabled())
+	cfg.ChangeLog.Stats = boolPtr(p.mglib.ChangeLogStats())
+	cfg.ChangeLog.MergeCommits = boolPtr(p.mglib.MergeCommits())
+
+	out, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	if p.configFile != "" {
+		fmt.Printf("# configuration file: %s\n", p.configFile)
+	}
+	fmt.Print(string(out))
+	return nil
+}
+
+func boolPtr(val bool) *bool {
+	return &val
+}
+
+func intPtr(val int) *int {
+	return &val
+}
+
+func floatPtr(val float64) *float64 {
+	return &val
+}
@@ -0,0 +1,76 @@
+package mgp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/mgl"
+)
+
+// writeConfig writes a configuration file and returns its name
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestConfigDockerTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    mgl.DockerTagPolicy
+	}{
+		{"static only", "c.yaml", "docker:\n  tags: {static: [stable]}\n",
+			mgl.DockerTagPolicy{GitTag: true, Latest: true, Static: []string{"stable"}}},
+		{"explicit false", "c.yaml", "docker:\n  tags: {latest: false, semVer: true}\n",
+			mgl.DockerTagPolicy{GitTag: true, SemVer: true}},
+		{"toml", "c.toml", "[docker.tags]\ngitTag = false\ngitRev = true\n",
+			mgl.DockerTagPolicy{GitRev: true, Latest: true}},
+		{"no tags", "c.yaml", "docker: {engine: podman}\n", mgl.DefaultDockerTagPolicy()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProject(t, WithConfigFile(writeConfig(t, tt.file, tt.content)))
+			if p.configErr != nil {
+				t.Fatal(p.configErr)
+			}
+			if !reflect.DeepEqual(p.dckTags, tt.want) {
+				t.Errorf("docker tag policy = %+v, want %+v", p.dckTags, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidConfigFile(t *testing.T) {
+	p := newTestProject(t, WithConfigFile(writeConfig(t, "c.yaml", "test: {count: many}\n")))
+	buildDir := filepath.Join(p.mglib.Workdir(), p.buildDir)
+	if err := os.MkdirAll(buildDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Test(); err == nil || err != p.configErr {
+		t.Errorf("Test() = %v, want the configuration error", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Clean removes the build dir relative to the current directory, as mage runs in workdir
+	if err := os.Chdir(p.mglib.Workdir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := p.Clean(); err != nil {
+		t.Errorf("Clean() = %v, want it to run despite the configuration error", err)
+	}
+	if _, err := os.Stat(buildDir); !os.IsNotExist(err) {
+		t.Errorf("build dir %s not removed", buildDir)
+	}
+}
@@ -0,0 +1,107 @@
+package mgp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+	"github.com/voyages-sncf-technologies/mageproj/v2/mgl"
+)
+
+// WithCoverage sets coverage to value, to measure the coverage of Test and report
+// it with Coverage
+func WithCoverage(val bool) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.coverage = val
+	}
+}
+
+// WithCoverageThreshold sets coverageMin to value, the minimum total coverage (in
+// percent of statements) below which Coverage fails
+func WithCoverageThreshold(val float64) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.coverageMin = val
+	}
+}
+
+// coverageDir returns the directory of the cover profiles of the test runs
+func (p *MageProject) coverageDir() string {
+	return filepath.Join(p.mglib.Workdir(), p.buildDir, "coverage")
+}
+
+// coverageArgs returns the go test arguments writing the cover profile of the
+// test run named name, covering all the packages of the project. The profiles of
+// previous runs are removed first, so that Coverage merges only the ones of this run
+func (p *MageProject) coverageArgs(name string) ([]string, error) {
+	dir := p.coverageDir()
+	p.coverageOnce.Do(func() {
+		util.Logf("Removing cover profiles of previous runs from %s", dir)
+		p.coverageErr = os.RemoveAll(dir)
+	})
+	if p.coverageErr != nil {
+		return nil, p.coverageErr
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return []string{"-covermode=atomic", "-coverpkg=./...", "-coverprofile=" + filepath.Join(dir, name+".out")}, nil
+}
+
+// Coverage merges the cover profiles of the test runs (unit tests, integration
+// tests...) of the last mage run measuring coverage into coverage.out, prints the coverage of each
+// package, writes an HTML (coverage.html) and a Cobertura (coverage.xml) report,
+// and fails if the total coverage is below the threshold
+func (p *MageProject) Coverage() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
+	util.AlwaysLog("===== coverage")
+
+	files, err := filepath.Glob(filepath.Join(p.coverageDir(), "*.out"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no cover profile in %s (see WithCoverage)", p.coverageDir())
+	}
+	sort.Strings(files)
+
+	var profiles []*mgl.CoverProfile
+	for _, f := range files {
+		util.Logf("Merging cover profile %s", f)
+		profile, err := mgl.ReadCoverProfile(f)
+		if err != nil {
+			return err
+		}
+		profiles = append(profiles, profile)
+	}
+	merged, err := mgl.MergeCoverProfiles(profiles...)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(p.mglib.Workdir(), p.buildDir)
+	out := filepath.Join(dir, "coverage.out")
+	if err := merged.Write(out); err != nil {
+		return err
+	}
+	if err := p.mglib.CoverageHTML(out, filepath.Join(dir, "coverage.html")); err != nil {
+		return err
+	}
+	if err := p.mglib.WriteCobertura(filepath.Join(dir, "coverage.xml"), merged); err != nil {
+		return err
+	}
+
+	for _, s := range merged.Packages() {
+		util.AlwaysLogf("%-60s %5.1f%% of %d statements", s.Package, s.Percent(), s.Statements)
+	}
+	total := merged.Total()
+	util.AlwaysLogf("%-60s %5.1f%% of %d statements", total.Package, total.Percent(), total.Statements)
+
+	if total.Percent() < p.coverageMin {
+		return fmt.Errorf("total coverage %.1f%% is below the minimum %.1f%%", total.Percent(), p.coverageMin)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package mgp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCoverageArgsRemovesPreviousProfiles(t *testing.T) {
+	p := newTestProject(t)
+	dir := p.coverageDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	stale := filepath.Join(dir, "integration.out")
+	if err := ioutil.WriteFile(stale, []byte("mode: atomic\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.coverageArgs("unit"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("profile of a previous run %s not removed", stale)
+	}
+
+	// the profiles of this run are kept
+	unit := filepath.Join(dir, "unit.out")
+	if err := ioutil.WriteFile(unit, []byte("mode: atomic\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	args, err := p.coverageArgs("integration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(unit); err != nil {
+		t.Errorf("profile of this run removed: %v", err)
+	}
+	if want := "-coverprofile=" + stale; args[len(args)-1] != want {
+		t.Errorf("coverageArgs() = %q, want last %q", args, want)
+	}
+}
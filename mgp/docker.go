@@ -0,0 +1,342 @@
+package mgp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/magefile/mage/mg"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+	"github.com/voyages-sncf-technologies/mageproj/v2/mgl"
+)
+
+const localRegistryName = "mageproj-registry"
+
+// containerEngine returns the container engine to use (docker, podman or buildah)
+func (p *MageProject) containerEngine() (mgl.ContainerEngine, error) {
+	return mgl.NewContainerEngine(p.engineName, p.env)
+}
+
+// buildImage returns the name of the image used by BuildWithDocker
+func (p *MageProject) buildImage() string {
+	return "tmp/" + p.projectName + ".build"
+}
+
+// BuildWithDocker builds binary in build dir using a Dockerfile.build file (see WithDockerBuildFile).
+// The container runs as the current user with the host Go module and build caches mounted,
+// and gets the same environment as a local build plus LDFLAGS and TAGS (build tags).
+func (p *MageProject) BuildWithDocker() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
+	engine, err := p.containerEngine()
+	if err != nil {
+		return err
+	}
+
+	p.checkBuildDir()
+
+	opts := mgl.BuildOptions{Dockerfile: p.dckBuildFile, Target: p.dckBuildTarget}
+	if err := engine.Build(p.buildImage(), opts); err != nil {
+		return err
+	}
+
+	env, err := p.envFlags()
+	if err != nil {
+		return err
+	}
+	env["LDFLAGS"] = os.Expand(p.linkFlags(), func(key string) string { return env[key] })
+	env["TAGS"] = p.buildTags()
+
+	run := mgl.RunOptions{Remove: true, Env: env}
+	run.Volumes = append(run.Volumes, filepath.Join(p.mglib.Workdir(), p.buildDir)+":"+path.Join(p.dckAppPath, p.buildDir))
+
+	// reuse the host caches instead of downloading modules at every run
+	if dir := p.goEnv("GOMODCACHE"); dir != "" {
+		run.Volumes = append(run.Volumes, dir+":/go/pkg/mod")
+		env["GOMODCACHE"] = "/go/pkg/mod"
+	}
+	if dir := p.goEnv("GOCACHE"); dir != "" {
+		run.Volumes = append(run.Volumes, dir+":/go/cache")
+		env["GOCACHE"] = "/go/cache"
+	}
+
+	// files written in build dir must belong to the current user, not root
+	run.HostUser = true
+	if os.Getuid() >= 0 {
+		env["HOME"] = "/tmp" // the user is unknown in the image
+	}
+
+	return engine.Run(p.buildImage(), run)
+}
+
+// goEnv returns the value of a go env variable, empty if unknown
+func (p *MageProject) goEnv(name string) string {
+	out, err := p.env.ExecOutput(p.env.GoCmd(), "env", name)
+	if err != nil {
+		return ""
+	}
+	return util.TrimString(out)
+}
+
+// dockerTarget returns the linux target of the image built from the binary of
+// Package, the one of the host architecture if built
+func (p *MageProject) dockerTarget() (target, error) {
+	var linux []target
+	for _, t := range p.targets {
+		if t.goos == "linux" {
+			if t.goarch == runtime.GOARCH {
+				return t, nil
+			}
+			linux = append(linux, t)
+		}
+	}
+	if len(linux) == 0 {
+		return target{}, errors.New("no linux target to build the Docker image from (see WithTargets)")
+	}
+	return linux[0], nil
+}
+
+// DockerBuildImage builds Docker image, either from the Dockerfile of the workdir or,
+// if a base image is set, from a generated Dockerfile copying the linux binary built
+// by Package, of the host architecture if among the targets
+func (p *MageProject) DockerBuildImage() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
+	var t target
+	if p.dckBase != "" {
+		var err error
+		if t, err = p.dockerTarget(); err != nil {
+			return err
+		}
+		mg.Deps(p.Package)
+	}
+
+	util.AlwaysLog("===== docker image")
+
+	engine, err := p.containerEngine()
+	if err != nil {
+		return err
+	}
+
+	dck := p.mglib.DockerDetails(p.dckRegistry, p.dckImage, "")
+
+	if p.dckBase == "" {
+		return engine.Build(dck.Image, mgl.BuildOptions{})
+	}
+
+	dockerfile, err := p.generateDockerfile()
+	if err != nil {
+		return err
+	}
+	opts := mgl.BuildOptions{Dockerfile: dockerfile, Context: p.buildDir,
+		BuildArgs: append(p.dockerBuildArgs(), "TARGETOS="+t.goos, "TARGETARCH="+t.goarch)}
+	if t.goarch != runtime.GOARCH {
+		opts.Platform = t.platform()
+	}
+	return engine.Build(dck.Image, opts)
+}
+
+// generateDockerfile writes the Dockerfile into the build dir and returns its path
+func (p *MageProject) generateDockerfile() (string, error) {
+	p.checkBuildDir()
+
+	dockerfile := filepath.Join(p.buildDir, "Dockerfile")
+	spec := mgl.DockerfileSpec{
+		BaseImage: p.dckBase,
+		Binary:    p.projectName,
+		AppPath:   p.dckAppPath,
+		Title:     p.projectName,
+		Source:    p.gitURL,
+		SBOM:      p.sbom,
+	}
+	return dockerfile, mgl.GenerateDockerfile(dockerfile, spec)
+}
+
+// dockerBuildArgs returns the build args used by the generated Dockerfile
+func (p *MageProject) dockerBuildArgs() []string {
+	env, _ := p.envFlags()
+	return []string{
+		"VERSION=" + env["VERSION"],
+		"BUILD_DATE=" + env["BUILD_DATE"],
+		"GIT_REV=" + env["GIT_REV"],
+	}
+}
+
+// DockerPushImage pushes Docker image to a repository with the tags given by the tag policy
+func (p *MageProject) DockerPushImage() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
+	util.AlwaysLog("===== docker release")
+
+	tags, err := p.mglib.DockerTags(p.dckTags)
+	if err != nil {
+		return err
+	}
+	if len(tags.Tags) == 0 && !tags.Latest {
+		return errors.New("no tag to push Docker image (a git tag is needed with the current tag policy)")
+	}
+
+	engine, err := p.containerEngine()
+	if err != nil {
+		return err
+	}
+
+	dck := p.mglib.DockerDetails(p.dckRegistry, p.dckImage, "")
+	if err := p.dockerLogin(engine, dck); err != nil {
+		return err
+	}
+
+	for _, tag := range tags.Tags {
+		if err := engine.Tag(dck.Image+":latest", dck.Image+":"+tag); err != nil {
+			return err
+		}
+		if err := engine.Push(dck.Image + ":" + tag); err != nil {
+			return err
+		}
+		util.AlwaysLogf("Pushed %s:%s", dck.Image, tag)
+	}
+
+	if tags.Latest {
+		if err := engine.Push(dck.Image + ":latest"); err != nil {
+			return err
+		}
+		util.AlwaysLogf("Pushed %s:latest", dck.Image)
+	} else if p.dckTags.Latest {
+		util.AlwaysLogf("Not pushing %s:latest: %s", dck.Image, tags.Reason)
+	}
+
+	return nil
+}
+
+// DockerBuildMultiArch builds and pushes a multi-architecture Docker image (manifest list)
+// for the linux targets of Package, with docker buildx or podman/buildah manifests.
+//
+// If MAGEFILEP_DOCKER_LOCAL_REGISTRY is set (e.g. localhost:5000), a registry:2 container
+// listening on this address is used instead of the Docker registry, for testing purpose.
+func (p *MageProject) DockerBuildMultiArch() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
+	if p.dckBase != "" {
+		mg.Deps(p.Package)
+	}
+
+	util.AlwaysLog("===== docker multi-arch image")
+
+	engine, err := p.containerEngine()
+	if err != nil {
+		return err
+	}
+
+	var platforms []string
+	for _, t := range p.targets {
+		if t.goos == "linux" {
+			platforms = append(platforms, t.platform())
+		}
+	}
+	if len(platforms) == 0 {
+		return errors.New("no linux target to build a multi-arch Docker image for")
+	}
+
+	tags, err := p.mglib.DockerTags(p.dckTags)
+	if err != nil {
+		return err
+	}
+	if tags.Latest {
+		tags.Tags = append(tags.Tags, "latest")
+	}
+	if len(tags.Tags) == 0 {
+		return errors.New("no tag to push Docker image (a git tag is needed with the current tag policy)")
+	}
+
+	dck := p.mglib.DockerDetails(p.dckRegistry, p.dckImage, "")
+	image := dck.Image
+
+	local := p.env.Get("MAGEFILEP_DOCKER_LOCAL_REGISTRY")
+	if local != "" {
+		if err := startLocalRegistry(engine, local); err != nil {
+			return err
+		}
+		image = local + "/" + imagePath(image)
+	} else if err := p.dockerLogin(engine, dck); err != nil {
+		return err
+	}
+
+	spec := mgl.MultiArchSpec{Platforms: platforms, Context: ".", Insecure: local != ""}
+	for _, tag := range tags.Tags {
+		spec.Images = append(spec.Images, image+":"+tag)
+	}
+	if p.dckBase != "" {
+		if spec.Dockerfile, err = p.generateDockerfile(); err != nil {
+			return err
+		}
+		spec.BuildArgs = p.dockerBuildArgs()
+		spec.Context = p.buildDir
+	}
+
+	if err := engine.BuildMultiArch(spec); err != nil {
+		return err
+	}
+
+	util.AlwaysLogf("Pushed %s for %s with tags %s", image, strings.Join(platforms, ","), strings.Join(tags.Tags, ","))
+	return nil
+}
+
+// dockerLogin logs in to the Docker registry, the password being given on stdin.
+// Login is skipped if no credentials are set but the engine configuration
+// already provides some for the registry.
+func (p *MageProject) dockerLogin(engine mgl.ContainerEngine, dck *mgl.DockerInfos) error {
+	if dck.Usr == "" && dck.Pwd == "" {
+		if engine.HasCredentials(dck.Registry) {
+			util.Logf("Using %s credentials for registry %q", engine.Name(), dck.Registry)
+			return nil
+		}
+		return fmt.Errorf("no credentials for Docker registry %q (set MAGEFILEP_DOCKER_USR and MAGEFILEP_DOCKER_PWD or run %s login)", dck.Registry, engine.Name())
+	}
+	if dck.Usr == "" {
+		return errors.New("missing user for Docker registry (set variable MAGEFILEP_DOCKER_USR)")
+	}
+	if dck.Pwd == "" {
+		return errors.New("missing password for Docker registry (set variable MAGEFILEP_DOCKER_PWD)")
+	}
+
+	if err := engine.Login(dck.Registry, dck.Usr, dck.Pwd); err != nil {
+		return fmt.Errorf("%s login to registry %q failed: %v", engine.Name(), dck.Registry, err)
+	}
+	return nil
+}
+
+// startLocalRegistry runs a registry:2 container on the given address, if not already running
+func startLocalRegistry(engine mgl.ContainerEngine, addr string) error {
+	if engine.IsRunning(localRegistryName) {
+		return nil
+	}
+
+	port := addr
+	if i := strings.LastIndex(addr, ":"); i >= 0 {
+		port = addr[i+1:]
+	}
+	engine.RemoveContainer(localRegistryName)
+	opts := mgl.RunOptions{Name: localRegistryName, Detach: true, Ports: []string{port + ":5000"}}
+	if err := engine.Run("registry:2", opts); err != nil {
+		return fmt.Errorf("unable to start local registry on %s: %v", addr, err)
+	}
+	return nil
+}
+
+// imagePath removes the registry host from an image name
+func imagePath(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[1]
+	}
+	return image
+}
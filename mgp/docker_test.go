@@ -0,0 +1,42 @@
+package mgp
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDockerTarget(t *testing.T) {
+	other := "arm64"
+	if runtime.GOARCH == other {
+		other = "amd64"
+	}
+	tests := []struct {
+		name    string
+		targets []string
+		want    string
+	}{
+		{"default targets", nil, "linux/amd64"},
+		{"host architecture first", []string{"windows/amd64", "linux/" + other, "linux/" + runtime.GOARCH}, "linux/" + runtime.GOARCH},
+		{"other architecture", []string{"darwin/arm64", "linux/" + other}, "linux/" + other},
+		{"no linux target", []string{"windows/amd64", "darwin/arm64"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var options []MageProjectOption
+			if tt.targets != nil {
+				options = append(options, WithTargets(tt.targets...))
+			}
+			got, err := newTestProject(t, options...).dockerTarget()
+			if tt.want == "" {
+				if err == nil || !strings.Contains(err.Error(), "no linux target") {
+					t.Errorf("dockerTarget() = %s, %v, want no linux target error", got.platform(), err)
+				}
+				return
+			}
+			if err != nil || got.platform() != tt.want {
+				t.Errorf("dockerTarget() = %s, %v, want %s", got.platform(), err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package mgp
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/magefile/mage/mg"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+	"github.com/voyages-sncf-technologies/mageproj/v2/mgl"
+)
+
+// WithFuzzTime sets fuzzTime to value, the duration each fuzz test runs (30s by
+// default), MAGEFILEP_FUZZ_TIME variable taking precedence
+func WithFuzzTime(val time.Duration) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.fuzzTime = val
+	}
+}
+
+// WithFuzzParallel sets fuzzParallel to value, the number of fuzz tests run at the
+// same time (1 by default, in sequence), MAGEFILEP_FUZZ_PARALLEL variable taking precedence
+func WithFuzzParallel(val int) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.fuzzParallel = val
+	}
+}
+
+// seedCorpusDir is the corpus dir keeping the generated inputs in the seed corpus of
+// each fuzz test (see WithFuzzCorpusDir)
+const seedCorpusDir = "testdata/fuzz"
+
+// WithFuzzCorpusDir sets fuzzCorpusDir to value, the directory relative to workdir
+// keeping the inputs generated by the fuzz tests between runs, MAGEFILEP_FUZZ_CORPUS_DIR
+// variable taking precedence. It is fuzz in build dir by default, to be cached by CI
+// without adding thousands of untracked inputs to the sources; with testdata/fuzz, they
+// are kept in the seed corpus of each fuzz test, next to the failing inputs.
+func WithFuzzCorpusDir(val string) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.fuzzCorpusDir = val
+	}
+}
+
+// fuzzSettings returns the duration of each fuzz test and the number of fuzz tests
+// run at the same time, MAGEFILEP_FUZZ_* variables taking precedence
+func (p *MageProject) fuzzSettings() (time.Duration, int, error) {
+	fuzztime, parallel := p.fuzzTime, p.fuzzParallel
+	if val := p.env.Get("MAGEFILEP_FUZZ_TIME"); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid MAGEFILEP_FUZZ_TIME %q: %v", val, err)
+		}
+		fuzztime = d
+	}
+	if val := p.env.Get("MAGEFILEP_FUZZ_PARALLEL"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid MAGEFILEP_FUZZ_PARALLEL %q: %v", val, err)
+		}
+		parallel = n
+	}
+	if parallel < 1 {
+		parallel = 1
+	}
+	return fuzztime, parallel, nil
+}
+
+// corpusDir returns the corpus dir, relative to workdir, MAGEFILEP_FUZZ_CORPUS_DIR
+// variable taking precedence
+func (p *MageProject) corpusDir() string {
+	if dir := p.env.Get("MAGEFILEP_FUZZ_CORPUS_DIR"); dir != "" {
+		return dir
+	}
+	if p.fuzzCorpusDir != "" {
+		return p.fuzzCorpusDir
+	}
+	return filepath.Join(p.buildDir, "fuzz")
+}
+
+// fuzzDir returns the directory keeping the inputs generated by the fuzz test: its
+// seed corpus, or its own directory in the corpus dir
+func (p *MageProject) fuzzDir(t mgl.FuzzTarget) string {
+	dir := p.corpusDir()
+	if filepath.ToSlash(filepath.Clean(dir)) == seedCorpusDir {
+		return t.CorpusDir()
+	}
+	return t.GeneratedDir(filepath.Join(p.mglib.Workdir(), dir))
+}
+
+// checkFuzzGoVersion verifies the go command supports fuzz tests (Go 1.18)
+func (p *MageProject) checkFuzzGoVersion() error {
+	gocmd := p.env.GoCmd()
+	version, err := p.mglib.ToolchainVersion(gocmd)
+	if err != nil {
+		return err
+	}
+	if min, _ := mgl.ParseGoVersion("1.18"); version.Compare(min) < 0 {
+		return fmt.Errorf("%s is Go %s, fuzz tests require Go 1.18 or later", gocmd, version)
+	}
+	return nil
+}
+
+// Fuzz runs the fuzz tests of the packages (the ones matching MAGEFILEP_FUZZ if set)
+// for the fuzz time each, in sequence or in parallel, keeping the generated corpus
+// in the corpus dir (see WithFuzzCorpusDir), and fails reporting the failing inputs
+// (written by go test under testdata/fuzz) with their reproducer. It requires Go 1.18.
+func (p *MageProject) Fuzz() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
+	mg.Deps(p.CheckGoVersion)
+	if err := p.checkFuzzGoVersion(); err != nil {
+		return err
+	}
+
+	util.AlwaysLog("===== fuzz")
+
+	fuzztime, parallel, err := p.fuzzSettings()
+	if err != nil {
+		return err
+	}
+	targets, err := p.mglib.FuzzTargets()
+	if err != nil {
+		return err
+	}
+	if pattern := p.env.Get("MAGEFILEP_FUZZ"); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid MAGEFILEP_FUZZ %q: %v", pattern, err)
+		}
+		var selected []mgl.FuzzTarget
+		for _, t := range targets {
+			if re.MatchString(t.Name) {
+				selected = append(selected, t)
+			}
+		}
+		targets = selected
+	}
+	if len(targets) == 0 {
+		util.AlwaysLog("No fuzz test found")
+		return nil
+	}
+
+	// the fuzzing workers of the CPUs are shared by the fuzz tests run at the same time
+	workers := runtime.NumCPU() / parallel
+	if workers < 1 {
+		workers = 1
+	}
+	flags := []string{"-parallel=" + strconv.Itoa(workers)}
+	if t := p.buildTags(); t != "" {
+		flags = append(flags, "-tags="+t)
+	}
+	env := p.env.With(mgl.Env{"GOFLAGS": p.testGoFlags()})
+	lib := mgl.NewMageLibrary(p.mglib.Workdir(), mgl.WithEnv(env))
+
+	results := make([]mgl.FuzzResult, len(targets))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, parallel)
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t mgl.FuzzTarget) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			util.AlwaysLogf("Fuzzing %s %s for %s", t.Package, t.Name, fuzztime)
+			results[i] = lib.Fuzz(t, fuzztime, flags, p.fuzzDir(t))
+		}(i, t)
+	}
+	wg.Wait()
+
+	var failed []string
+	for _, r := range results {
+		if r.Err == nil {
+			util.Logf("%s %s: ok", r.Target.Package, r.Target.Name)
+			continue
+		}
+		failed = append(failed, r.Target.Package+" "+r.Target.Name)
+		if len(r.Crashers) == 0 {
+			util.AlwaysLogf("%s %s failed: %v\n%s", r.Target.Package, r.Target.Name, r.Err, r.Output)
+			continue
+		}
+		if p.env.Verbose() {
+			util.AlwaysLog(r.Output)
+		}
+		for _, crasher := range r.Crashers {
+			util.AlwaysLogf("%s %s found a failing input %s, to re-run: %s", r.Target.Package, r.Target.Name,
+				crasher, r.Reproducer(crasher))
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d fuzz tests failed: %s", len(failed), len(results), strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package mgp
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/mgl"
+)
+
+func TestFuzzDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []MageProjectOption
+		env     mgl.Env
+		want    string // relative to workdir
+	}{
+		{"default", nil, nil, filepath.Join("build", "fuzz", "mycompany.fr", "myapp", "codec", "FuzzDecode")},
+		{"build dir", []MageProjectOption{WithBuildDir("out")}, nil, filepath.Join("out", "fuzz", "mycompany.fr", "myapp", "codec", "FuzzDecode")},
+		{"corpus dir", []MageProjectOption{WithFuzzCorpusDir(".fuzz")}, nil, filepath.Join(".fuzz", "mycompany.fr", "myapp", "codec", "FuzzDecode")},
+		{"seed corpus", []MageProjectOption{WithFuzzCorpusDir("testdata/fuzz")}, nil, filepath.Join("codec", "testdata", "fuzz", "FuzzDecode")},
+		{"variable", []MageProjectOption{WithFuzzCorpusDir(".fuzz")}, mgl.Env{"MAGEFILEP_FUZZ_CORPUS_DIR": "testdata/fuzz/"}, filepath.Join("codec", "testdata", "fuzz", "FuzzDecode")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProject(t, append(tt.options, WithEnv(tt.env))...)
+			target := mgl.FuzzTarget{Package: "mycompany.fr/myapp/codec", Dir: filepath.Join(p.mglib.Workdir(), "codec"), Name: "FuzzDecode"}
+			if got, want := p.fuzzDir(target), filepath.Join(p.mglib.Workdir(), tt.want); got != want {
+				t.Errorf("fuzzDir() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestFuzzRequiresGo118(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake go command is a shell script")
+	}
+	gocmd := filepath.Join(t.TempDir(), "go")
+	script := "#!/bin/sh\necho go version go1.17.13 linux/amd64\n"
+	if err := ioutil.WriteFile(gocmd, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newTestProject(t, WithEnv(mgl.Env{"MAGEFILE_GOCMD": gocmd}))
+	err := p.checkFuzzGoVersion()
+	if err == nil || !strings.Contains(err.Error(), "is Go 1.17.13, fuzz tests require Go 1.18 or later") {
+		t.Errorf("checkFuzzGoVersion() = %v, want Go 1.18 required", err)
+	}
+	if err := newTestProject(t).checkFuzzGoVersion(); err != nil {
+		t.Errorf("checkFuzzGoVersion() with the go command = %v, want nil", err)
+	}
+}
@@ -0,0 +1,130 @@
+package mgp
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+	"github.com/voyages-sncf-technologies/mageproj/v2/mgl"
+)
+
+// WithGoVersion sets goMin and goMax to value, the range of Go versions required
+// to build the project (e.g. "1.21" and "1.23", max excluded, empty for no limit),
+// the go and toolchain directives of go.mod giving the min by default
+func WithGoVersion(min, max string) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.goMin = min
+		ml.goMax = max
+	}
+}
+
+// WithGoSelect sets goSelect to value, to select an installed Go toolchain matching
+// the required versions when the go command does not, instead of failing,
+// MAGEFILEP_GO_SELECT variable taking precedence
+func WithGoSelect(val bool) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.goSelect = val
+	}
+}
+
+// goVersionRange returns the range of Go versions required: at least the version
+// set (or the go.mod one) and MageLibrary one, below the max version if set
+func (p *MageProject) goVersionRange() (min, max *mgl.GoVersion, err error) {
+	minVersions := []string{mgl.MinGoVersion, p.goMin}
+	if p.goMin == "" {
+		goVersion, toolchain, err := p.mglib.GoModVersions()
+		if err != nil && !os.IsNotExist(err) {
+			return nil, nil, err
+		}
+		minVersions = append(minVersions, goVersion, toolchain)
+	}
+	for _, s := range minVersions {
+		if s == "" {
+			continue
+		}
+		v, err := mgl.ParseGoVersion(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		if min == nil || v.Compare(*min) > 0 {
+			min = &v
+		}
+	}
+	if p.goMax != "" {
+		v, err := mgl.ParseGoVersion(p.goMax)
+		if err != nil {
+			return nil, nil, err
+		}
+		max = &v
+	}
+	return min, max, nil
+}
+
+func goVersionMatches(v mgl.GoVersion, min, max *mgl.GoVersion) bool {
+	return (min == nil || v.Compare(*min) >= 0) && (max == nil || v.Compare(*max) < 0)
+}
+
+func formatGoVersionRange(min, max *mgl.GoVersion) string {
+	var r []string
+	if min != nil {
+		r = append(r, ">= "+min.String())
+	}
+	if max != nil {
+		r = append(r, "< "+max.String())
+	}
+	return strings.Join(r, ", ")
+}
+
+// CheckGoVersion verifies the version of the go command (MAGEFILE_GOCMD or go) is in
+// the range required (see WithGoVersion); if not and toolchain selection is enabled
+// (see WithGoSelect), it uses the latest installed toolchain in the range: the one
+// named by GOTOOLCHAIN, a goX.Y.Z command of golang.org/dl or one of ~/sdk
+func (p *MageProject) CheckGoVersion() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
+	min, max, err := p.goVersionRange()
+	if err != nil {
+		return fmt.Errorf("invalid required Go version: %v", err)
+	}
+	required := formatGoVersionRange(min, max)
+
+	gocmd := p.env.GoCmd()
+	active, err := p.mglib.ToolchainVersion(gocmd)
+	if err != nil {
+		return err
+	}
+	if goVersionMatches(active, min, max) {
+		util.Logf("Using Go %s (%s), required %s", active, gocmd, required)
+		return nil
+	}
+
+	if !p.envBool("MAGEFILEP_GO_SELECT", p.goSelect) {
+		return fmt.Errorf("%s is Go %s, not the required Go version %s: install a matching toolchain "+
+			"(e.g. go install golang.org/dl/goX.Y.Z@latest) or enable its selection with MAGEFILEP_GO_SELECT=yes",
+			gocmd, active, required)
+	}
+	var found []string
+	for _, t := range p.mglib.FindGoToolchains() {
+		if goVersionMatches(t.Version, min, max) {
+			util.AlwaysLogf("Using Go %s (%s) instead of Go %s, required %s", t.Version, t.GoCmd, active, required)
+			p.useGoCmd(t.GoCmd)
+			return nil
+		}
+		found = append(found, t.Version.String())
+	}
+	installed := "none found"
+	if len(found) > 0 {
+		installed = "found Go " + strings.Join(found, ", ")
+	}
+	return fmt.Errorf("%s is Go %s, not the required Go version %s, and no matching toolchain is installed (%s)",
+		gocmd, active, required, installed)
+}
+
+// useGoCmd makes the targets run the go command, as is (GOTOOLCHAIN=local)
+func (p *MageProject) useGoCmd(gocmd string) {
+	env := mgl.Env{"MAGEFILE_GOCMD": gocmd, "GOTOOLCHAIN": "local"}
+	p.env = p.env.With(env)
+	mgl.WithEnv(env)(p.mglib)
+}
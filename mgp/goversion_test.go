@@ -0,0 +1,101 @@
+package mgp
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/mgl"
+)
+
+func TestGoVersionRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		gomod    string // none if empty
+		min, max string
+		want     string
+	}{
+		{"no go.mod", "", "", "", ">= 1.17"},
+		{"go directive", "go 1.21\n", "", "", ">= 1.21"},
+		{"toolchain above go", "go 1.21.0\ntoolchain go1.22.3\n", "", "", ">= 1.22.3"},
+		{"toolchain below go", "go 1.22\ntoolchain go1.22rc1\n", "", "", ">= 1.22"},
+		{"go below library", "go 1.16\n", "", "", ">= 1.17"},
+		{"explicit min over go.mod", "go 1.22\ntoolchain go1.22.3\n", "1.21", "", ">= 1.21"},
+		{"explicit min below library", "go 1.22\n", "1.15", "", ">= 1.17"},
+		{"explicit max", "go 1.21\n", "", "1.23", ">= 1.21, < 1.23"},
+		{"explicit range", "", "1.20", "1.22rc1", ">= 1.20, < 1.22rc1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProject(t, WithGoVersion(tt.min, tt.max))
+			if tt.gomod != "" {
+				gomod := "module mycompany.fr/myapp\n\n" + tt.gomod
+				if err := ioutil.WriteFile(filepath.Join(p.mglib.Workdir(), "go.mod"), []byte(gomod), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			min, max, err := p.goVersionRange()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := formatGoVersionRange(min, max); got != tt.want {
+				t.Errorf("goVersionRange() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	p := newTestProject(t)
+	if err := ioutil.WriteFile(filepath.Join(p.mglib.Workdir(), "go.mod"), []byte("go 1.x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := p.goVersionRange(); err == nil {
+		t.Error("goVersionRange() with an invalid go.mod version succeeded")
+	}
+}
+
+func TestGoVersionMatches(t *testing.T) {
+	v := func(s string) *mgl.GoVersion {
+		version, err := mgl.ParseGoVersion(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &version
+	}
+	tests := []struct {
+		version  string
+		min, max *mgl.GoVersion
+		want     bool
+	}{
+		{"1.21.3", nil, nil, true},
+		{"1.21.0", v("1.21"), nil, true},
+		{"1.21rc10", v("1.21rc9"), v("1.21"), true},
+		{"1.21rc9", v("1.21rc10"), nil, false},
+		{"1.23.0", v("1.21"), v("1.23"), false},
+		{"1.23rc1", v("1.21"), v("1.23"), true},
+	}
+	for _, tt := range tests {
+		if got := goVersionMatches(*v(tt.version), tt.min, tt.max); got != tt.want {
+			t.Errorf("goVersionMatches(%s, %s) = %v, want %v", tt.version, formatGoVersionRange(tt.min, tt.max), got, tt.want)
+		}
+	}
+}
+
+func TestCheckGoVersionNoMatchingToolchain(t *testing.T) {
+	gocmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	t.Setenv("HOME", t.TempDir())
+	p := newTestProject(t, WithGoVersion("1.99", ""), WithGoSelect(true),
+		WithEnv(mgl.Env{"MAGEFILE_GOCMD": gocmd, "PATH": t.TempDir(), "GOTOOLCHAIN": "local"}))
+
+	err = p.CheckGoVersion()
+	if err == nil {
+		t.Fatal("CheckGoVersion() = nil, want an error")
+	}
+	if want := "no matching toolchain is installed (none found)"; !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("CheckGoVersion() = %v, want it to end with %q", err, want)
+	}
+}
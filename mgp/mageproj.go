@@ -8,7 +8,9 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/magefile/mage/mg"
@@ -23,18 +25,61 @@ type MageProjectOption func(*MageProject)
 
 // MageProject provides Mage dependent high level targets to reuse as is
 type MageProject struct {
-	projectName string
-	groupName   string
-	buildDir    string
-	packageName string
-	ldFlags     string
-	testFlags   string
-	dckRegistry string
-	dckImage    string
-	dckAppPath  string
-	artifactURL string
-	gitURL      string
-	mglib       *mgl.MageLibrary
+	projectName    string
+	groupName      string
+	buildDir       string
+	packageName    string
+	mainPkg        string
+	ldFlags        string
+	testFlags      string
+	buildTagList   []string
+	testRace       bool
+	testShort      bool
+	testShuffle    string
+	testCount      int
+	testRetries    int
+	integrationTag string
+	benchPattern   string
+	benchCount     int
+	benchBaseline  string
+	benchThreshold float64
+	fuzzTime       time.Duration
+	fuzzParallel   int
+	fuzzCorpusDir  string
+	goMin          string
+	goMax          string
+	goSelect       bool
+	dckRegistry    string
+	dckImage       string
+	dckAppPath     string
+	dckBuildFile   string
+	dckBuildTarget string
+	dckTags        mgl.DockerTagPolicy
+	dckBase        string
+	engineName     string
+	sbom           bool
+	sbomScanner    string
+	sbomSeverity   string
+	targets        []target
+	artifactURL    string
+	gitURL         string
+	baseRef        string
+	importsLocal   string
+	linters        []string
+	lintSeverity   string
+	tools          []mgl.Tool
+	reports        bool
+	coverage       bool
+	coverageMin    float64
+	coverageOnce   sync.Once
+	coverageErr    error
+	configFile     string
+	configErr      error
+	buildTime      time.Time
+	env            mgl.Env
+	mglib          *mgl.MageLibrary
+	buildinfoOnce  sync.Once
+	buildinfoUsed  bool
 }
 
 type target struct {
@@ -42,26 +87,68 @@ type target struct {
 	goarch string
 }
 
-// NewMageProject constructs a new MageProject instance
-func NewMageProject(workdir, projectName, packageName string, options ...MageProjectOption) *MageProject {
-	// We want to use Go 1.11 modules even if the source lives inside GOPATH.
-	// The default is "auto".
-	os.Setenv("GO111MODULE", "on")
+// default targets built by Package
+var packageTargets = []target{
+	{"windows", "amd64"},
+	{"darwin", "amd64"},
+	{"linux", "amd64"},
+}
+
+func (t target) platform() string {
+	return t.goos + "/" + t.goarch
+}
 
+// NewMageProject constructs a new MageProject instance. If its configuration file
+// cannot be loaded, the targets fail with this error.
+func NewMageProject(workdir, projectName, packageName string, options ...MageProjectOption) *MageProject {
 	proj := &MageProject{}
 	proj.projectName = projectName
 	proj.packageName = packageName
 	proj.buildDir = "build"
+	proj.mainPkg = "."
 	proj.dckAppPath = "/app"
+	proj.dckBuildFile = "Dockerfile.build"
+	proj.dckTags = mgl.DefaultDockerTagPolicy()
+	proj.targets = packageTargets
+	proj.integrationTag = "integration"
+	proj.benchPattern = "."
+	proj.benchCount = 5
+	proj.benchThreshold = 10
+	proj.fuzzTime = 30 * time.Second
+	proj.fuzzParallel = 1
+	proj.buildTime = time.Now()
 
-	proj.mglib = mgl.NewMageLibrary(workdir)
+	// We want to use Go 1.11 modules even if the source lives inside GOPATH.
+	// The default is "auto". The process environment is left untouched.
+	proj.env = mgl.Env{"GO111MODULE": "on"}
 
 	for _, option := range options {
 		option(proj)
 	}
+
+	proj.mglib = proj.newLibrary(workdir)
+
+	// a configuration file overrides the options given in code
+	if err := proj.loadConfig(); err != nil {
+		util.AlwaysLogf("Unable to load configuration: %v", err)
+		proj.configErr = err
+	}
+	if dir := proj.reportsDir(); dir != "" {
+		mgl.WithReportsDir(dir)(proj.mglib)
+	}
 	return proj
 }
 
+// NewMageProjectE constructs a new MageProject instance and checks its configuration
+// (see CheckConfig)
+func NewMageProjectE(workdir, projectName, packageName string, options ...MageProjectOption) (*MageProject, error) {
+	proj := NewMageProject(workdir, projectName, packageName, options...)
+	if err := proj.CheckConfig(); err != nil {
+		return nil, err
+	}
+	return proj, nil
+}
+
 // WithGroupName sets groupName to value
 func WithGroupName(val string) MageProjectOption {
 	return func(ml *MageProject) {
@@ -76,6 +163,14 @@ func WithBuildDir(val string) MageProjectOption {
 	}
 }
 
+// WithMainPackage sets mainPkg to value, the main package built relative to workdir
+// (e.g. ./cmd/app), the root one by default
+func WithMainPackage(val string) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.mainPkg = val
+	}
+}
+
 // WithCompileFlags sets ldFlags to value
 func WithCompileFlags(val string) MageProjectOption {
 	return func(ml *MageProject) {
@@ -90,6 +185,53 @@ func WithTestFlags(val string) MageProjectOption {
 	}
 }
 
+// WithBuildTags sets the build tags of Build, Package and Test to value
+func WithBuildTags(val ...string) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.buildTagList = val
+	}
+}
+
+// WithTestRace sets testRace to value, to run tests with the race detector,
+// MAGEFILEP_TEST_RACE variable taking precedence
+func WithTestRace(val bool) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.testRace = val
+	}
+}
+
+// WithTestShort sets testShort to value, to run the unit tests of Test in short
+// mode (-short), MAGEFILEP_TEST_SHORT variable taking precedence
+func WithTestShort(val bool) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.testShort = val
+	}
+}
+
+// WithTestShuffle sets testShuffle to value (on, off or a seed), to run tests in
+// random order, MAGEFILEP_TEST_SHUFFLE variable taking precedence
+func WithTestShuffle(val string) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.testShuffle = val
+	}
+}
+
+// WithTestCount sets testCount to value, the number of times each test runs (1
+// disables the test cache), MAGEFILEP_TEST_COUNT variable taking precedence
+func WithTestCount(val int) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.testCount = val
+	}
+}
+
+// WithIntegrationTag sets integrationTag to value, the build tag of the integration
+// tests run by IntegrationTest (integration by default)
+func WithIntegrationTag(val string) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.integrationTag = val
+	}
+}
+
 // WithDockerRegistry sets dckRegistry to value
 func WithDockerRegistry(val string) MageProjectOption {
 	return func(ml *MageProject) {
@@ -111,6 +253,114 @@ func WithDockerAppPath(val string) MageProjectOption {
 	}
 }
 
+// WithDockerBuildFile sets dckBuildFile to value
+func WithDockerBuildFile(val string) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.dckBuildFile = val
+	}
+}
+
+// WithDockerBuildTarget sets dckBuildTarget to value
+func WithDockerBuildTarget(val string) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.dckBuildTarget = val
+	}
+}
+
+// WithDockerTagPolicy sets dckTags to value
+func WithDockerTagPolicy(val mgl.DockerTagPolicy) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.dckTags = val
+	}
+}
+
+// WithDockerBaseImage sets dckBase to value (e.g. scratch or gcr.io/distroless/static).
+// When set, DockerBuildImage generates its Dockerfile from the binaries built by Package.
+func WithDockerBaseImage(val string) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.dckBase = val
+	}
+}
+
+// WithTargets sets targets to value, given as goos/goarch (e.g. linux/arm64), instead of
+// windows/amd64, darwin/amd64 and linux/amd64
+func WithTargets(val ...string) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.targets = nil
+		for _, platform := range val {
+			// malformed platforms are kept to be reported by CheckConfig
+			parts := strings.SplitN(platform, "/", 2)
+			if len(parts) == 1 {
+				parts = append(parts, "")
+			}
+			ml.targets = append(ml.targets, target{parts[0], parts[1]})
+		}
+	}
+}
+
+// WithContainerEngine sets engineName to value (docker, podman or buildah),
+// MAGEFILEP_CONTAINER_ENGINE variable taking precedence
+func WithContainerEngine(val string) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.engineName = val
+	}
+}
+
+// WithSBOM sets sbom to value, to generate SBOMs of the binaries when packaged
+func WithSBOM(val bool) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.sbom = val
+	}
+}
+
+// WithSBOMScanner sets sbomScanner (grype or trivy) and sbomSeverity (negligible,
+// low, medium, high or critical) to values
+func WithSBOMScanner(scanner, severity string) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.sbomScanner = scanner
+		ml.sbomSeverity = severity
+	}
+}
+
+// WithEnv adds the variables to env, the environment given to the commands run
+// by the project, on top of the process environment which is never modified
+func WithEnv(val mgl.Env) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.env = ml.env.With(val)
+	}
+}
+
+// WithImportsLocal sets importsLocal to value, the import path prefix goimports
+// puts after 3rd-party packages (e.g. mycompany.fr/myapp)
+func WithImportsLocal(val string) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.importsLocal = val
+	}
+}
+
+// WithLinters sets linters to value (golangci-lint, staticcheck or revive), run by Validate
+func WithLinters(val ...string) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.linters = val
+	}
+}
+
+// WithLintSeverity sets lintSeverity to value (info, warning or error), the lowest
+// severity of the lint issues failing Validate
+func WithLintSeverity(val string) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.lintSeverity = val
+	}
+}
+
+// WithTools adds the tools to the manifest of InstallDeps (see mgl.Tools), to pin
+// versions other than the default ones or to install additional tools
+func WithTools(val ...mgl.Tool) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.tools = append(ml.tools, val...)
+	}
+}
+
 // WithArtifactURL sets artifactURL to value
 func WithArtifactURL(val string) MageProjectOption {
 	return func(ml *MageProject) {
@@ -125,6 +375,20 @@ func WithGitURL(val string) MageProjectOption {
 	}
 }
 
+// newLibrary constructs the Mage library of the project, or of one of its modules
+func (p *MageProject) newLibrary(workdir string) *mgl.MageLibrary {
+	options := []mgl.MageLibraryOption{mgl.WithEnv(p.env), mgl.WithImportsLocal(p.importsLocal),
+		mgl.WithLinters(p.linters...), mgl.WithTools(p.tools...)}
+	if p.lintSeverity != "" {
+		options = append(options, mgl.WithLintSeverity(p.lintSeverity))
+	}
+	if p.mglib != nil {
+		// modules share the tools of the project
+		options = append(options, mgl.WithToolsDir(p.mglib.ToolsDir()))
+	}
+	return mgl.NewMageLibrary(workdir, options...)
+}
+
 // MageLibrary gets Mage library used by this project
 func (p *MageProject) MageLibrary() *mgl.MageLibrary {
 	return p.mglib
@@ -132,7 +396,7 @@ func (p *MageProject) MageLibrary() *mgl.MageLibrary {
 
 // Logf logs message if verbose mode is on.
 func Logf(msg string, v ...interface{}) {
-	util.Logf(msg, v) // shortcut for user
+	util.Logf(msg, v...) // shortcut for user
 }
 
 // Log logs message if verbose mode is on.
@@ -140,75 +404,218 @@ func Log(msg string) {
 	util.Log(msg) // shortcut for user
 }
 
+// import path of the runtime package populated by linkFlags
+const buildinfoPkg = "github.com/voyages-sncf-technologies/mageproj/v2/buildinfo"
+
+// linkFlags returns the ldflags of the builds, setting the buildinfo values when the
+// main package imports it
 func (p *MageProject) linkFlags() string {
-	return p.ldFlags
+	flags := p.ldFlags
+	if p.importsBuildinfo() {
+		bi := fmt.Sprintf(`-X "%[1]s.version=$VERSION" -X "%[1]s.commit=$GIT_REV" -X "%[1]s.buildDate=$BUILD_DATE"`, buildinfoPkg)
+		flags = strings.TrimSpace(flags + " " + bi)
+	}
+	return flags
+}
+
+// importsBuildinfo reports whether the main package depends on the buildinfo package,
+// looked up once for all the builds
+func (p *MageProject) importsBuildinfo() bool {
+	p.buildinfoOnce.Do(func() {
+		var flags []string
+		if t := p.buildTags(); t != "" {
+			flags = append(flags, "-tags="+t)
+		}
+		p.buildinfoUsed = p.mglib.ImportsPackage(p.mainPkg, buildinfoPkg, flags...)
+	})
+	return p.buildinfoUsed
 }
 
 func (p *MageProject) envFlags() (map[string]string, error) {
 	version := p.mglib.Version()
+	git, _ := p.mglib.GitDetails()
 
 	return map[string]string{
 		"PACKAGE":    p.packageName,
 		"VERSION":    version,
-		"BUILD_DATE": time.Now().Format("2006-01-02T15:04:05Z0700"),
+		"BUILD_DATE": p.buildDate(),
+		"GIT_REV":    git.Rev,
 	}, nil
 }
 
+func (p *MageProject) buildDate() string {
+	return p.buildTime.Format("2006-01-02T15:04:05Z0700")
+}
+
 func (p *MageProject) testGoFlags() string {
 	return p.testFlags
 }
 
-func (p *MageProject) buildTags() string {
-	return ""
+// buildTags returns the build tags, comma separated, with the additional tags
+func (p *MageProject) buildTags(tags ...string) string {
+	var all []string
+	for _, t := range append(append([]string{}, p.buildTagList...), tags...) {
+		if t != "" {
+			all = append(all, t)
+		}
+	}
+	return strings.Join(all, ",")
+}
+
+// shortTests returns whether the unit tests run in short mode, MAGEFILEP_TEST_SHORT
+// variable taking precedence
+func (p *MageProject) shortTests() bool {
+	return p.envBool("MAGEFILEP_TEST_SHORT", p.testShort)
 }
 
-// Validate runs go format and linters
+// testArgs returns the go test flags of a run: -short if short, the test options,
+// MAGEFILEP_TEST_* variables taking precedence, and the build tags with the
+// additional tags
+func (p *MageProject) testArgs(short bool, tags ...string) []string {
+	var args []string
+	if short {
+		args = append(args, "-short")
+	}
+	if p.envBool("MAGEFILEP_TEST_RACE", p.testRace) {
+		args = append(args, "-race")
+	}
+	shuffle := p.testShuffle
+	if val := p.env.Get("MAGEFILEP_TEST_SHUFFLE"); val != "" {
+		shuffle = val
+	}
+	if shuffle != "" {
+		args = append(args, "-shuffle="+shuffle)
+	}
+	count := ""
+	if p.testCount > 0 {
+		count = strconv.Itoa(p.testCount)
+	}
+	if val := p.env.Get("MAGEFILEP_TEST_COUNT"); val != "" {
+		count = val
+	}
+	if count != "" {
+		args = append(args, "-count="+count)
+	}
+	if run := p.env.Get("MAGEFILEP_TEST_RUN"); run != "" {
+		args = append(args, "-run="+run)
+	}
+	if t := p.buildTags(tags...); t != "" {
+		args = append(args, "-tags="+t)
+	}
+	return args
+}
+
+// testPackages returns the packages to test, MAGEFILEP_TEST_PKGS (e.g. "./mgl/... ./mgp")
+// or all of them
+func (p *MageProject) testPackages() []string {
+	if pkgs := strings.Fields(p.env.Get("MAGEFILEP_TEST_PKGS")); len(pkgs) > 0 {
+		return pkgs
+	}
+	return []string{"./..."}
+}
+
+// envBool returns whether the variable is set to "yes", or def if not set
+func (p *MageProject) envBool(key string, def bool) bool {
+	if val, present := p.env.Lookup(key); present {
+		return val == "yes"
+	}
+	return def
+}
+
+// Validate checks the Go version, then runs go format and linters
 func (p *MageProject) Validate() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
+	mg.Deps(p.CheckGoVersion)
 	mg.Deps(p.mglib.InstallDeps)
 	mg.Deps(p.mglib.Format, p.mglib.Vet)
+	if len(p.linters) > 0 {
+		mg.Deps(p.mglib.Lint)
+	}
 
 	util.AlwaysLog("===== validate")
 	return nil
 }
 
-// Test runs tests with go test
+// FormatFix formats code in place with gofmt and goimports
+func (p *MageProject) FormatFix() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
+	util.AlwaysLog("===== format fix")
+	return p.mglib.FormatFix()
+}
+
+// Test runs unit tests with go test, in short mode if enabled (see WithTestShort)
 func (p *MageProject) Test() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
 	util.AlwaysLog("===== test")
+	return p.runTests("unit", p.testArgs(p.shortTests()))
+}
 
-	env := map[string]string{"GOFLAGS": p.testGoFlags()}
+// IntegrationTest runs integration tests with go test, the tests built with the
+// integration tag (see WithIntegrationTag) being included
+func (p *MageProject) IntegrationTest() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
+	util.AlwaysLog("===== integration test")
+	return p.runTests("integration", p.testArgs(false, p.integrationTag))
+}
 
-	tags := ""
-	if t := p.buildTags(); t != "" {
-		tags = "-tags" + t
+// runTests runs go test with the arguments on the packages to test, measuring
+// the coverage of the run if enabled
+func (p *MageProject) runTests(name string, args []string) error {
+	env := p.env.With(mgl.Env{"GOFLAGS": p.testGoFlags()})
+
+	run := testRun{name: name, flags: args, pkgs: p.testPackages()}
+	if p.coverage {
+		cover, err := p.coverageArgs(name)
+		if err != nil {
+			return err
+		}
+		run.cover = cover
 	}
 
-	return sh.RunWith(env, mg.GoCmd(), "test", "./...", tags)
+	if err := p.goTest(env, p.mglib, run); err != nil {
+		return err
+	}
+	if p.coverage {
+		return p.Coverage()
+	}
+	return nil
 }
 
-func (p *MageProject) dumpInfoToDisk() error {
+func (p *MageProject) dumpInfoToDisk(targets []target, files []string) error {
 	p.checkBuildDir()
 
-	info := p.PrintInfo()
-	if info != "" {
-		f := filepath.Join(p.MageLibrary().Workdir(), p.buildDir, "build-info.json")
-		return ioutil.WriteFile(f, []byte(info), 0644)
+	info, err := p.buildInfo(targets, files)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return info.Write(filepath.Join(p.MageLibrary().Workdir(), p.buildDir, "build-info.json"))
 }
 
 // Build builds binary in build dir
 func (p *MageProject) Build() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
+	mg.Deps(p.CheckGoVersion)
 	mg.Deps(p.Validate)
 	mg.Deps(p.Test)
 
 	util.AlwaysLog("===== build")
 
 	util.Log("Building for current OS and architecture")
-	_, err := p.buildSpecific(target{})
+	exe, err := p.buildSpecific(target{})
 
 	if err == nil {
-		err = p.dumpInfoToDisk()
+		err = p.dumpInfoToDisk([]target{{p.goEnv("GOOS"), p.goEnv("GOARCH")}}, []string{exe})
 	}
 
 	return err
@@ -216,18 +623,18 @@ func (p *MageProject) Build() error {
 
 // Package packages cross platform binaries in build dir
 func (p *MageProject) Package() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
 	mg.Deps(p.Validate)
 	mg.Deps(p.Test)
 
 	util.AlwaysLog("===== package")
 
+	var artifacts []string
+
 	version := p.mglib.Version()
-	targets := []target{
-		{"windows", "amd64"},
-		{"darwin", "amd64"},
-		{"linux", "amd64"},
-	}
-	for _, t := range targets {
+	for _, t := range p.targets {
 		util.Logf("Building for OS %s and architecture %s\n", t.goos, t.goarch)
 
 		exe, err := p.buildSpecific(t)
@@ -240,22 +647,66 @@ func (p *MageProject) Package() error {
 			"README.md",
 		}
 
+		archive := p.archiveName(t, version)
 		if t.goos == "windows" {
-			archiveName := fmt.Sprintf("%s_%s_%s-%s.zip", p.projectName, version, t.goos, t.goarch)
-			util.ZipFiles(filepath.Join(p.buildDir, archiveName), files)
+			util.ZipFiles(archive, files)
 		} else {
-			archiveName := fmt.Sprintf("%s_%s_%s-%s.tar.gz", p.projectName, version, t.goos, t.goarch)
-			util.TarFiles(filepath.Join(p.buildDir, archiveName), files, false)
+			util.TarFiles(archive, files, false)
+		}
+		artifacts = append(artifacts, archive)
+
+		// keep the binary so that the Docker image contains the archived one
+		keep := p.dckBase != "" && t.goos == "linux"
+		if keep {
+			if exe, err = p.keepBinary(exe, t); err != nil {
+				return err
+			}
+		}
+
+		if p.sbom {
+			sboms, err := p.writeSBOM(exe, t, version, keep)
+			if err != nil {
+				return err
+			}
+			artifacts = append(artifacts, sboms...)
+		}
+
+		if !keep {
+			os.Remove(exe)
 		}
+	}
 
-		os.Remove(exe)
+	return p.dumpInfoToDisk(p.targets, artifacts)
+}
+
+// archiveName returns the path of the archive of the binary built for the target
+func (p *MageProject) archiveName(t target, version string) string {
+	ext := ".tar.gz"
+	if t.goos == "windows" {
+		ext = ".zip"
 	}
+	return filepath.Join(p.buildDir, fmt.Sprintf("%s_%s_%s-%s%s", p.projectName, version, t.goos, t.goarch, ext))
+}
 
-	return p.dumpInfoToDisk()
+// keptBinary returns the path of the binary kept for the target (see keepBinary)
+func (p *MageProject) keptBinary(t target) string {
+	return filepath.Join(p.buildDir, t.goos+"-"+t.goarch, p.binaryName(t))
+}
+
+// keepBinary moves the binary into the <goos>-<goarch> dir of the build dir
+func (p *MageProject) keepBinary(exe string, t target) (string, error) {
+	kept := p.keptBinary(t)
+	if err := os.MkdirAll(filepath.Dir(kept), 0755); err != nil {
+		return "", err
+	}
+	return kept, os.Rename(exe, kept)
 }
 
 // Deploy deploys cross platform binaries to artifacts registry
 func (p *MageProject) Deploy() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
 	mg.Deps(p.Package)
 
 	util.AlwaysLog("===== deploy")
@@ -264,7 +715,10 @@ func (p *MageProject) Deploy() error {
 
 	dir := filepath.Join(p.mglib.Workdir(), p.buildDir)
 	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if filepath.Ext(path) == ".zip" || strings.HasSuffix(path, ".tar.gz") {
+		if info != nil && info.IsDir() && path != dir {
+			return filepath.SkipDir // binaries kept per target are not deployed
+		}
+		if filepath.Ext(path) == ".zip" || strings.HasSuffix(path, ".tar.gz") || isSBOM(path) {
 			files = append(files, path)
 		}
 		return nil
@@ -340,14 +794,17 @@ func (p *MageProject) Deploy() error {
 
 // Release creates a git tag and push it to remote
 func (p *MageProject) Release() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
 	util.AlwaysLog("===== release")
 
-	val, present := os.LookupEnv("MAGEFILEP_VERSION")
+	val, present := p.env.Lookup("MAGEFILEP_VERSION")
 	if !present {
 		return errors.New("MAGEFILEP_VERSION environment variable is required")
 	}
 
-	out, e := util.ExecOutput(util.GitCmd(), "status", "--porcelain")
+	out, e := p.env.ExecOutput(p.env.GitCmd(), "status", "--porcelain")
 	if e != nil {
 		return e
 	}
@@ -360,18 +817,18 @@ func (p *MageProject) Release() error {
 	tag := fmt.Sprintf("v%s", val)
 	msg := fmt.Sprintf("Version %s", val)
 
-	if err = util.RunCmd(util.GitCmd(), "tag", "-a", tag, "-m", msg); err != nil {
+	if err = p.env.RunCmd(p.env.GitCmd(), "tag", "-a", tag, "-m", msg); err != nil {
 		return err
 	}
 
-	if err = util.RunCmd(util.GitCmd(), "push", "origin", tag); err != nil {
+	if err = p.env.RunCmd(p.env.GitCmd(), "push", "origin", tag); err != nil {
 		return err
 	}
 
 	defer func() {
 		if err != nil {
-			sh.Run("git", "tag", "--delete", tag)
-			sh.Run("git", "push", "--delete", "origin", tag)
+			p.env.RunCmd(p.env.GitCmd(), "tag", "--delete", tag)
+			p.env.RunCmd(p.env.GitCmd(), "push", "--delete", "origin", tag)
 		}
 	}()
 
@@ -389,22 +846,41 @@ func (p *MageProject) buildSpecific(t target) (string, error) {
 		envFlags["GOOS"] = t.goos
 		envFlags["GOARCH"] = t.goarch
 	}
-
-	exe := filepath.Join(p.buildDir, p.projectName)
-	if t.goos == "windows" {
-		exe += ".exe"
+	if p.dckBase != "" && t.goos == "linux" {
+		// scratch or distroless images need a static binary
+		envFlags["CGO_ENABLED"] = "0"
 	}
 
-	ldflags := ""
+	exe := filepath.Join(p.buildDir, p.binaryName(t))
+
+	args := []string{"build", "-o", exe}
+	if t := p.buildTags(); t != "" {
+		args = append(args, "-tags="+t)
+	}
 	if f := p.linkFlags(); f != "" {
-		ldflags = "-ldflags=" + f
+		args = append(args, "-ldflags="+f)
 	}
+	args = append(args, p.mainPkg)
 
-	err = sh.RunWith(envFlags, mg.GoCmd(), "build", "-o", exe, ldflags)
+	// variables of the link flags are expanded as sh.RunWith does
+	env := p.env.With(envFlags)
+	for i := range args {
+		args[i] = env.Expand(args[i])
+	}
+
+	err = env.RunCmdStreamed(env.GoCmd(), args...)
 	return exe, err
 }
 
-// Clean removes the build directory
+// binaryName returns the name of the binary built for the target
+func (p *MageProject) binaryName(t target) string {
+	if t.goos == "windows" {
+		return p.projectName + ".exe"
+	}
+	return p.projectName
+}
+
+// Clean removes the build directory, even with an invalid configuration file
 func (p *MageProject) Clean() error {
 	util.AlwaysLog("===== clean")
 
@@ -415,7 +891,8 @@ func (p *MageProject) Clean() error {
 	return nil
 }
 
-// CleanAll removes the build directory and the docker image used for build
+// CleanAll removes the build directory and the docker image used for build, even
+// with an invalid configuration file
 func (p *MageProject) CleanAll() error {
 	util.AlwaysLog("===== clean all")
 
@@ -423,17 +900,19 @@ func (p *MageProject) CleanAll() error {
 		util.AlwaysLog(fmt.Sprint(err))
 	}
 
-	docker := sh.RunCmd("docker")
-	dockerImage := "tmp/" + p.projectName + ".build"
+	engine, err := p.containerEngine()
+	if err != nil {
+		util.AlwaysLog(fmt.Sprint(err))
+		return nil
+	}
 
-	imgs, err := util.ExecOutput("docker", "images", "-q", dockerImage)
+	ids, err := engine.ImageIDs(p.buildImage())
 	if err != nil {
 		util.AlwaysLog(fmt.Sprint(err))
 	}
 
-	imgs = util.TrimString(imgs)
-	if len(imgs) > 0 {
-		if err := docker("rmi", "--force", imgs); err != nil {
+	if len(ids) > 0 {
+		if err := engine.RemoveImages(ids...); err != nil {
 			util.AlwaysLog(fmt.Sprint(err))
 		}
 	}
@@ -441,6 +920,12 @@ func (p *MageProject) CleanAll() error {
 	return nil
 }
 
+// configFileErr returns the error of the configuration file, if any, which fails
+// every target but Clean and CleanAll
+func (p *MageProject) configFileErr() error {
+	return p.configErr
+}
+
 func (p *MageProject) checkBuildDir() {
 	path := filepath.Join(p.MageLibrary().Workdir(), p.buildDir)
 	if _, err := os.Stat(path); os.IsNotExist(err) {
@@ -448,102 +933,45 @@ func (p *MageProject) checkBuildDir() {
 	}
 }
 
-// BuildWithDocker builds binary in build dir using a Dockerfile.build file
-func (p *MageProject) BuildWithDocker() error {
-	dockerImage := "tmp/" + p.projectName + ".build"
-
-	p.checkBuildDir()
-
-	docker := sh.RunCmd("docker")
-	if err := docker("build", "-t", dockerImage, "-f", "Dockerfile.build", "."); err != nil {
-		return err
-	}
-
-	vol := filepath.Join(p.mglib.Workdir(), p.buildDir) + ":" + filepath.Join(p.dckAppPath, p.buildDir)
-	if err := docker("run", "-v", vol, dockerImage); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// DockerBuildImage builds Docker image
-func (p *MageProject) DockerBuildImage() error {
-	util.AlwaysLog("===== docker image")
-
-	dck := p.mglib.DockerDetails(p.dckRegistry, p.dckImage, "")
-
-	docker := sh.RunCmd("docker")
-	if err := docker("build", "-t", dck.Image, "."); err != nil {
-		return err
-	}
-	return nil
-}
-
-// DockerPushImage pushes Docker image to a repository
-func (p *MageProject) DockerPushImage() error {
-	util.AlwaysLog("===== docker release")
-
-	git, _ := p.mglib.GitDetails()
-	if git.TagAtRev == "" {
-		return errors.New("a git tag is needed to push Docker image")
-	}
-
+// buildInfo gathers information regarding the build of the given targets,
+// producing the given files
+func (p *MageProject) buildInfo(targets []target, files []string) (*mgl.BuildInfo, error) {
+	art := p.mglib.ArtifactDetails(p.artifactURL, "")
 	dck := p.mglib.DockerDetails(p.dckRegistry, p.dckImage, "")
 
-	docker := sh.RunCmd("docker")
-	if err := docker("login", dck.Registry, "-u", dck.Usr, "-p", dck.Pwd); err != nil {
-		return err
-	}
-	if err := docker("tag", dck.Image+":latest", dck.Image+":"+git.TagAtRev); err != nil {
-		return err
-	}
-	if err := docker("push", dck.Image+":"+git.TagAtRev); err != nil {
-		return err
+	info := p.mglib.NewBuildInfo(art, dck)
+	info.BuildDate = p.buildDate()
+	info.GoVersion = p.goEnv("GOVERSION")
+	for _, t := range targets {
+		info.Targets = append(info.Targets, t.platform())
 	}
-
-	if git.Rev == git.RevAtLatestTag {
-		if err := docker("push", dck.Image+":latest"); err != nil {
-			return err
+	for _, f := range files {
+		if err := info.AddFile(f); err != nil {
+			return nil, err
 		}
 	}
-
-	return nil
+	return info, nil
 }
 
 // PrintInfo prints information used internally
 func (p *MageProject) PrintInfo() string {
-	var sb strings.Builder
-	sb.WriteString("{")
-	sb.WriteString(`"workdir": "` + p.mglib.Workdir() + `", `)
-
-	git, _ := p.mglib.GitDetails()
-	sb.WriteString(`"git": {`)
-	sb.WriteString(`"rev": "` + git.Rev + `", `)
-	sb.WriteString(`"tagAtRev": "` + git.TagAtRev + `", `)
-	sb.WriteString(`"latestTag": "` + git.LatestTag + `", `)
-	sb.WriteString(`"revAtLatestTag": "` + git.RevAtLatestTag + `"`)
-	sb.WriteString("}, ")
-
-	art := p.mglib.ArtifactDetails(p.artifactURL, "")
-	sb.WriteString(`"artifact": {`)
-	sb.WriteString(`"url": "` + art.URL + `"`)
-	sb.WriteString("}, ")
-
-	dck := p.mglib.DockerDetails(p.dckRegistry, p.dckImage, "")
-	sb.WriteString(`"docker": {`)
-	sb.WriteString(`"registry": "` + dck.Registry + `", `)
-	sb.WriteString(`"image": "` + dck.Image + `"`)
-	sb.WriteString("}")
-
-	sb.WriteString("}")
-
-	return sb.String()
+	info, err := p.buildInfo(nil, nil)
+	if err != nil {
+		return ""
+	}
+	s, err := info.JSON()
+	if err != nil {
+		return ""
+	}
+	return s
 }
 
 // ChangeLog generates a ChangeLog based on git history
 func (p *MageProject) ChangeLog() error {
-	val, present := os.LookupEnv("MAGEFILEP_VERSION")
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
+	val, present := p.env.Lookup("MAGEFILEP_VERSION")
 	if !present {
 		return errors.New("MAGEFILEP_VERSION environment variable is required")
 	}
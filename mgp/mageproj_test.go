@@ -0,0 +1,46 @@
+package mgp
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/mgl"
+)
+
+func TestShortTests(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "mageproj.yaml")
+	if err := ioutil.WriteFile(config, []byte("test: {short: true}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		options []MageProjectOption
+		want    bool
+	}{
+		{"default", nil, false},
+		{"option", []MageProjectOption{WithTestShort(true)}, true},
+		{"config file", []MageProjectOption{WithConfigFile(config)}, true},
+		{"variable over option", []MageProjectOption{WithTestShort(true), WithEnv(mgl.Env{"MAGEFILEP_TEST_SHORT": "no"})}, false},
+		{"variable", []MageProjectOption{WithEnv(mgl.Env{"MAGEFILEP_TEST_SHORT": "yes"})}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProject(t, tt.options...)
+			if got := p.shortTests(); got != tt.want {
+				t.Errorf("shortTests() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTestArgs(t *testing.T) {
+	p := newTestProject(t, WithTestRace(true), WithTestCount(1), WithBuildTags("netgo"))
+	if got, want := p.testArgs(false, "integration"), []string{"-race", "-count=1", "-tags=netgo,integration"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("testArgs(false) = %q, want %q", got, want)
+	}
+	if got, want := p.testArgs(true), []string{"-short", "-race", "-count=1", "-tags=netgo"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("testArgs(true) = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,28 @@
+package mgp
+
+import (
+	"path/filepath"
+)
+
+// WithReports sets reports to value, to write machine-readable reports of Format,
+// Vet, Lint (SARIF, Checkstyle and GitLab Code Quality) and tests (JUnit XML) into
+// reports in build dir, MAGEFILEP_REPORTS variable taking precedence
+func WithReports(val bool) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.reports = val
+	}
+}
+
+// reportsEnabled reports whether reports are written, MAGEFILEP_REPORTS taking
+// precedence over WithReports
+func (p *MageProject) reportsEnabled() bool {
+	return p.envBool("MAGEFILEP_REPORTS", p.reports)
+}
+
+// reportsDir returns the directory of the reports, empty if not enabled
+func (p *MageProject) reportsDir() string {
+	if !p.reportsEnabled() {
+		return ""
+	}
+	return filepath.Join(p.mglib.Workdir(), p.buildDir, "reports")
+}
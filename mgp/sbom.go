@@ -0,0 +1,157 @@
+package mgp
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/magefile/mage/mg"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+	"github.com/voyages-sncf-technologies/mageproj/v2/mgl"
+)
+
+const (
+	cycloneDXExt = ".cdx.json"
+	spdxExt      = ".spdx.json"
+)
+
+// SBOM generates CycloneDX and SPDX documents for the binaries built by Package,
+// recording them in build-info.json, then runs the vulnerability scanner if any
+// (see WithSBOMScanner)
+func (p *MageProject) SBOM() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
+	mg.Deps(p.Package)
+
+	util.AlwaysLog("===== sbom")
+
+	version := p.mglib.Version()
+	var generated []string
+	for _, t := range p.targets {
+		if !p.sbom {
+			sboms, err := p.writeArchivedSBOM(t, version)
+			if err != nil {
+				return err
+			}
+			generated = append(generated, sboms...)
+		}
+
+		if p.sbomScanner != "" {
+			sbom := sbomFile(p.buildDir, p.sbomPrefix(t, version), cycloneDXExt)
+			util.AlwaysLogf("Scanning %s with %s", sbom, p.sbomScanner)
+			if err := p.mglib.ScanSBOM(p.sbomScanner, sbom, p.sbomSeverity); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(generated) == 0 {
+		return nil
+	}
+	return p.addToBuildInfo(generated)
+}
+
+// writeArchivedSBOM writes the SBOMs of the binary kept for the target, or else of the
+// binary extracted from its archive, the binaries being removed once packaged
+func (p *MageProject) writeArchivedSBOM(t target, version string) ([]string, error) {
+	if exe := p.keptBinary(t); isFile(exe) {
+		return p.writeSBOM(exe, t, version, true)
+	}
+
+	archive := p.archiveName(t, version)
+	dir, err := ioutil.TempDir(p.buildDir, "sbom")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	exe := filepath.Join(dir, p.binaryName(t))
+	if t.goos == "windows" {
+		err = util.UnzipFile(archive, p.binaryName(t), exe)
+	} else {
+		err = util.UntarFile(archive, p.binaryName(t), exe)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("binary not found in %s, run Package first: %v", archive, err)
+	}
+	return p.writeSBOM(exe, t, version, false)
+}
+
+// addToBuildInfo adds files to the build-info.json written by Package
+func (p *MageProject) addToBuildInfo(files []string) error {
+	filename := filepath.Join(p.mglib.Workdir(), p.buildDir, "build-info.json")
+	info, err := mgl.LoadBuildInfo(filename)
+	if os.IsNotExist(err) {
+		info, err = p.buildInfo(p.targets, nil)
+	}
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := info.AddFile(f); err != nil {
+			return err
+		}
+	}
+	return info.Write(filename)
+}
+
+// writeSBOM writes the SBOMs of a binary next to the archives, and if embed is set,
+// next to the binary itself for Docker images to embed them. It returns the former.
+func (p *MageProject) writeSBOM(exe string, t target, version string, embed bool) ([]string, error) {
+	if _, err := os.Stat(exe); err != nil {
+		return nil, errors.New("binary not found, run Package first: " + exe)
+	}
+
+	bin, err := p.mglib.ReadModules(exe)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := p.sbomPrefix(t, version)
+	dirs := []string{p.buildDir}
+	if embed {
+		dirs = append(dirs, filepath.Dir(exe))
+	}
+	for _, dir := range dirs {
+		name := ""
+		if dir == p.buildDir {
+			name = prefix
+		}
+		if err := mgl.WriteCycloneDX(sbomFile(dir, name, cycloneDXExt), p.projectName, version, bin); err != nil {
+			return nil, err
+		}
+		if err := mgl.WriteSPDX(sbomFile(dir, name, spdxExt), p.projectName, version, bin); err != nil {
+			return nil, err
+		}
+	}
+
+	util.Logf("SBOM generated for %s", exe)
+	return []string{sbomFile(p.buildDir, prefix, cycloneDXExt), sbomFile(p.buildDir, prefix, spdxExt)}, nil
+}
+
+// sbomPrefix returns the name of the SBOMs of the target, next to the archives
+func (p *MageProject) sbomPrefix(t target, version string) string {
+	return fmt.Sprintf("%s_%s_%s-%s", p.projectName, version, t.goos, t.goarch)
+}
+
+// sbomFile returns the SBOM file path, named sbom<ext> if no name is given
+func sbomFile(dir, name, ext string) string {
+	if name == "" {
+		name = "sbom"
+	}
+	return filepath.Join(dir, name+ext)
+}
+
+func isSBOM(path string) bool {
+	return strings.HasSuffix(path, cycloneDXExt) || strings.HasSuffix(path, spdxExt)
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,81 @@
+package mgp
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+	"github.com/voyages-sncf-technologies/mageproj/v2/mgl"
+)
+
+// WithTestRetries sets testRetries to value, the number of times the failed tests
+// are re-run before failing, MAGEFILEP_TEST_RETRIES variable taking precedence
+func WithTestRetries(val int) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.testRetries = val
+	}
+}
+
+// testRun holds a go test run
+type testRun struct {
+	name  string   // unit, integration... naming its reports
+	flags []string // go test flags, given to retries too
+	cover []string // coverage flags, given to the first run only
+	pkgs  []string // packages to test
+}
+
+// retries returns the number of times the failed tests are re-run, MAGEFILEP_TEST_RETRIES
+// taking precedence over WithTestRetries
+func (p *MageProject) retries() int {
+	if val, err := strconv.Atoi(p.env.Get("MAGEFILEP_TEST_RETRIES")); err == nil {
+		return val
+	}
+	return p.testRetries
+}
+
+// goTest runs go test in the workdir of lib, re-running the failed tests if retries
+// are enabled, the tests passing on retry being reported as flaky (<name>.flaky.json).
+// The go test -json events (<name>.json) and JUnit XML (<name>.junit.xml) reports are
+// written into the reports dir of lib if enabled.
+func (p *MageProject) goTest(env mgl.Env, lib *mgl.MageLibrary, run testRun) error {
+	args := append(append(append([]string{}, run.flags...), run.cover...), run.pkgs...)
+	dir := lib.ReportsDir()
+	retries := p.retries()
+	if dir == "" && retries <= 0 {
+		return env.RunCmdStreamedIn(lib.Workdir(), env.GoCmd(), append([]string{"test"}, args...)...)
+	}
+
+	events, testErr := mgl.GoTestJSON(env, lib.Workdir(), args...)
+	if testErr != nil && retries > 0 {
+		var flaky []mgl.FlakyTest
+		events, flaky, testErr = mgl.RetryFailedTests(env, lib.Workdir(), retries, run.flags, events, testErr)
+		for _, t := range flaky {
+			util.AlwaysLogf("Flaky test %s %s passed after %d failed runs", t.Package, t.Test, t.Failures)
+		}
+
+		flakyDir := dir
+		if flakyDir == "" {
+			flakyDir = filepath.Join(lib.Workdir(), p.buildDir)
+		}
+		if err := os.MkdirAll(flakyDir, 0755); err != nil {
+			return err
+		}
+		if err := mgl.WriteFlakyTests(filepath.Join(flakyDir, run.name+".flaky.json"), flaky); err != nil {
+			return err
+		}
+	}
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err := mgl.WriteTestEvents(filepath.Join(dir, run.name+".json"), events); err != nil {
+			return err
+		}
+		if err := mgl.WriteJUnit(filepath.Join(dir, run.name+".junit.xml"), events); err != nil {
+			return err
+		}
+	}
+	return testErr
+}
@@ -0,0 +1,38 @@
+package mgp
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/mgl"
+)
+
+func TestTestFailsWithRetriesAndNoTestFailed(t *testing.T) {
+	tests := []struct {
+		name string
+		env  mgl.Env
+	}{
+		{"invalid count", mgl.Env{"MAGEFILEP_TEST_COUNT": "x"}},
+		{"invalid shuffle", mgl.Env{"MAGEFILEP_TEST_SHUFFLE": "sometimes"}},
+		{"no package", mgl.Env{"MAGEFILEP_TEST_PKGS": "./missing/..."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := tt.env.With(mgl.Env{"GOFLAGS": "", "MAGEFILEP_TEST_RETRIES": "1"})
+			p := newTestProject(t, WithEnv(env))
+			files := map[string]string{
+				"go.mod":     "module mycompany.fr/myapp\n\ngo 1.17\n",
+				"ok_test.go": "package myapp\n\nimport \"testing\"\n\nfunc TestOK(t *testing.T) {}\n",
+			}
+			for name, content := range files {
+				if err := ioutil.WriteFile(filepath.Join(p.mglib.Workdir(), name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := p.Test(); err == nil {
+				t.Error("Test() succeeded, want the go test error")
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package mgp
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/magefile/mage/mg"
+
+	"github.com/voyages-sncf-technologies/mageproj/v2/internal/util"
+	"github.com/voyages-sncf-technologies/mageproj/v2/mgl"
+)
+
+// WithBaseRef sets baseRef to value, the git ref (e.g. origin/main) against which
+// the modules affected by changes are detected, MAGEFILEP_BASE_REF variable taking
+// precedence. When empty, the *Modules targets run on all the modules.
+func WithBaseRef(val string) MageProjectOption {
+	return func(ml *MageProject) {
+		ml.baseRef = val
+	}
+}
+
+// moduleResult holds the outcome of a target on a module
+type moduleResult struct {
+	module   mgl.WorkspaceModule
+	err      error
+	duration time.Duration
+}
+
+// modules returns the modules of the workspace to run targets on: all of them,
+// or only the affected ones if a base ref is set
+func (p *MageProject) modules() ([]mgl.WorkspaceModule, error) {
+	modules, err := p.mglib.WorkspaceModules()
+	if err != nil {
+		return nil, err
+	}
+
+	base := p.baseRef
+	if ref := p.env.Get("MAGEFILEP_BASE_REF"); ref != "" {
+		base = ref
+	}
+	if base == "" {
+		return modules, nil
+	}
+
+	affected, err := p.mglib.AffectedModules(modules, base)
+	if err != nil {
+		return nil, err
+	}
+	util.AlwaysLogf("%d of %d modules affected by changes since %s", len(affected), len(modules), base)
+	return affected, nil
+}
+
+// forEachModule runs fn on each module, even if it fails on some of them, then
+// reports the outcome for all of them
+func (p *MageProject) forEachModule(fn func(lib *mgl.MageLibrary) error) error {
+	modules, err := p.modules()
+	if err != nil {
+		return err
+	}
+
+	var results []moduleResult
+	for _, m := range modules {
+		util.AlwaysLogf("----- module %s (%s)", m.Path, m.Dir)
+		lib := p.newLibrary(filepath.Join(p.mglib.Workdir(), m.Dir))
+		if dir := p.reportsDir(); dir != "" {
+			mgl.WithReportsDir(filepath.Join(dir, m.Dir))(lib)
+		}
+
+		start := time.Now()
+		err := fn(lib)
+		results = append(results, moduleResult{m, err, time.Since(start)})
+	}
+
+	return reportModules(results)
+}
+
+// reportModules logs the outcome of a target on each module, and returns an
+// error naming the modules which failed
+func reportModules(results []moduleResult) error {
+	util.AlwaysLog("----- modules report")
+
+	var failed []string
+	for _, r := range results {
+		status := "ok  "
+		if r.err != nil {
+			status = "FAIL"
+			failed = append(failed, r.module.Path)
+		}
+		line := fmt.Sprintf("%s %s (%s) %s", status, r.module.Path, r.module.Dir, r.duration.Round(time.Millisecond))
+		if r.err != nil {
+			line += ": " + r.err.Error()
+		}
+		util.AlwaysLog(line)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d modules failed: %s", len(failed), len(results), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// ValidateModules runs go format and linters on each module of the workspace
+func (p *MageProject) ValidateModules() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
+	mg.Deps(p.CheckGoVersion)
+	mg.Deps(p.mglib.InstallDeps)
+
+	util.AlwaysLog("===== validate modules")
+	return p.forEachModule(func(lib *mgl.MageLibrary) error {
+		if err := lib.Format(); err != nil {
+			return err
+		}
+		if err := lib.Vet(); err != nil {
+			return err
+		}
+		if len(p.linters) > 0 {
+			return lib.Lint()
+		}
+		return nil
+	})
+}
+
+// TestModules checks the Go version, then runs unit tests with go test on each module
+// of the workspace, in short mode if enabled (see WithTestShort)
+func (p *MageProject) TestModules() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
+	mg.Deps(p.CheckGoVersion)
+
+	util.AlwaysLog("===== test modules")
+
+	env := p.env.With(mgl.Env{"GOFLAGS": p.testGoFlags()})
+	run := testRun{name: "unit", flags: p.testArgs(p.shortTests()), pkgs: p.testPackages()}
+	return p.forEachModule(func(lib *mgl.MageLibrary) error {
+		return p.goTest(env, lib, run)
+	})
+}
+
+// BuildModules checks the Go version, then compiles the packages of each module of
+// the workspace
+func (p *MageProject) BuildModules() error {
+	if err := p.configFileErr(); err != nil {
+		return err
+	}
+	mg.Deps(p.CheckGoVersion)
+
+	util.AlwaysLog("===== build modules")
+
+	return p.forEachModule(func(lib *mgl.MageLibrary) error {
+		args := []string{"build"}
+		if t := p.buildTags(); t != "" {
+			args = append(args, "-tags="+t)
+		}
+		return p.env.RunCmdStreamedIn(lib.Workdir(), p.env.GoCmd(), append(args, "./...")...)
+	})
+}